@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -12,6 +13,8 @@ import (
 	"github.com/hiveot/hub/lib/hubclient"
 	"github.com/hiveot/hub/lib/listener"
 	"github.com/hiveot/hub/lib/svcconfig"
+	"github.com/hiveot/hub/pkg/directory"
+	dirclient "github.com/hiveot/hub/pkg/directory/capnpclient"
 	"github.com/hiveot/hub/pkg/pubsub"
 	"github.com/hiveot/hub/pkg/pubsub/capnpclient"
 
@@ -19,12 +22,19 @@ import (
 )
 
 func main() {
+	// validate mode checks the TDs of the devices in a simulation file, eg docs/owserver-simulation.xml
+	if len(os.Args) == 3 && os.Args[1] == "validate" {
+		os.Exit(validateTDs(os.Args[2]))
+	}
 	f, bindingCert, caCert := svcconfig.SetupFolderConfig(internal.DefaultBindingID)
 	bindingConfig := internal.NewBindingConfig()
 	_ = f.LoadConfig(&bindingConfig)
+	if bindingConfig.StoreFolder == "" {
+		bindingConfig.StoreFolder = f.Stores
+	}
 
 	//logging.SetLogging(bindingConfig.Loglevel, hubConfig.LogFile)
-	pubSubSvc, rpcConn, err := ConnectToHub(
+	pubSubSvc, dirSvc, rpcConn, err := ConnectToHub(
 		bindingConfig.BindingID,
 		bindingConfig.HubURL,
 		bindingCert, caCert)
@@ -34,8 +44,11 @@ func main() {
 	}
 
 	binding := internal.NewOWServerBinding(bindingConfig, pubSubSvc)
+	// the directory removes the TDs of retired and replaced devices
+	binding.SetTDRemover(dirSvc)
 	ctx := listener.ExitOnSignal(context.Background(), nil)
 	err = binding.Start(ctx)
+	dirSvc.Release()
 	_ = rpcConn.Close()
 
 	if err != nil {
@@ -45,17 +58,47 @@ func main() {
 	os.Exit(0)
 }
 
-// ConnectToHub obtains the pubsub client from the Hub
+// ConnectToHub obtains the pubsub and directory clients from the Hub
 func ConnectToHub(instanceID, fullUrl string,
-	bindingCert *tls.Certificate, caCert *x509.Certificate) (pubsub.IDevicePubSub, *rpc.Conn, error) {
+	bindingCert *tls.Certificate, caCert *x509.Certificate) (
+	pubsub.IDevicePubSub, directory.IUpdateDirectory, *rpc.Conn, error) {
 
 	rpcConn, hubClient, err := hubclient.ConnectToHubClient(fullUrl, bindingCert, caCert)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	//cl, err := hubclient.GetDevicePubSubClient(conn, instanceID)
 	pubsubCl := capnpclient.NewPubSubClient(hubClient)
 	deviceClient, err := pubsubCl.CapDevicePubSub(context.Background(), instanceID)
+	if err != nil {
+		_ = rpcConn.Close()
+		return nil, nil, nil, err
+	}
+	dirCl := dirclient.NewDirectoryClient(hubClient)
+	updateDir, err := dirCl.CapUpdateDirectory(context.Background(), instanceID)
+	if err != nil {
+		deviceClient.Release()
+		_ = rpcConn.Close()
+		return nil, nil, nil, fmt.Errorf("unable to obtain the directory: %w", err)
+	}
+	return deviceClient, updateDir, rpcConn, nil
+}
 
-	return deviceClient, rpcConn, err
+// validateTDs prints the violations of the TDs generated from a simulation file.
+// This returns 0 if all TDs are valid and 1 otherwise.
+func validateTDs(simulationFile string) int {
+	violations, err := internal.ValidateSimulationTDs(simulationFile)
+	if err != nil {
+		fmt.Printf("unable to read '%s': %s\n", simulationFile, err)
+		return 1
+	}
+	for _, violation := range violations {
+		fmt.Println(violation)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("%d violations found\n", len(violations))
+		return 1
+	}
+	fmt.Println("all TDs are valid")
+	return 0
 }
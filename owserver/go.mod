@@ -5,6 +5,7 @@ go 1.19
 require (
 	capnproto.org/go/capnp/v3 v3.0.0-alpha.24
 	github.com/hiveot/hub v0.0.0-20230225055025-2dbb9b760fdc
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/stretchr/testify v1.8.2
 )
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"strconv"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// Scale converts the raw input voltage to engineering units
+func (cfg AnalogConfig) Scale(raw float64) float64 {
+	if cfg.RawHigh == cfg.RawLow {
+		return raw
+	}
+	return cfg.Low + (raw-cfg.RawLow)*(cfg.High-cfg.Low)/(cfg.RawHigh-cfg.RawLow)
+}
+
+// ApplyAnalogScaling replaces the voltage of configured DS2450 inputs with the value in
+// engineering units.
+func (binding *OWServerBinding) ApplyAnalogScaling(node *eds.OneWireNode) {
+	inputs, found := binding.Config.AnalogInputs[binding.configID(node.NodeID)]
+	if !found {
+		return
+	}
+	for channel, cfg := range inputs {
+		attrID := eds.DS2450InputID(channel)
+		attr, found := node.Attr[attrID]
+		if !found {
+			continue
+		}
+		raw, err := strconv.ParseFloat(attr.Value, 64)
+		if err != nil {
+			continue
+		}
+		if cfg.Decimals != nil {
+			attr.Decimals = *cfg.Decimals
+		}
+		attr.Value = strconv.FormatFloat(cfg.Scale(raw), 'f', attr.Decimals, 64)
+		if cfg.Unit != "" {
+			attr.Unit = cfg.Unit
+		}
+		if cfg.Title != "" {
+			attr.Name = cfg.Title
+		}
+		node.Attr[attrID] = attr
+	}
+}
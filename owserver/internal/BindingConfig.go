@@ -26,6 +26,7 @@ type OWServerBindingConfig struct {
 	Password  string `yaml:"password,omitempty"`
 
 	// TDInterval optional override interval of republishing the full TD, in seconds.
+	// TDs of new nodes, or nodes whose structure changes, are published on the next poll.
 	// Default is 12 hours
 	TDInterval int `yaml:"tdInterval,omitempty"`
 
@@ -36,6 +37,242 @@ type OWServerBindingConfig struct {
 	// RepublishInterval optional override interval that unmodified Thing values are republished, in seconds.
 	// Default is 3600 seconds
 	RepublishInterval int `yaml:"republishInterval,omitempty"`
+
+	// ThingIDTemplate optional template of the thing ID of 1-wire devices and the gateway.
+	// Placeholders are {romId}, {bindingID} and {gatewayMAC}, eg "{gatewayMAC}-{romId}".
+	// Default is "{romId}".
+	ThingIDTemplate string `yaml:"thingIDTemplate,omitempty"`
+
+	// Aliases optional thing IDs by ROMId that replace the thing ID template, eg "livingroom-thermometer"
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// UnavailablePolls optional number of polls a device can be missing before it becomes unavailable.
+	// Default is 3.
+	UnavailablePolls int `yaml:"unavailablePolls,omitempty"`
+
+	// RetireHours optional number of hours after which a missing device is retired and its TD is
+	// removed. Use 0 to keep missing devices. Default is 168 hours (one week).
+	RetireHours int `yaml:"retireHours,omitempty"`
+
+	// Counters optional scaling of pulse counters, by ROMId and counter name, eg Counter1
+	Counters map[string]map[string]CounterConfig `yaml:"counters,omitempty"`
+
+	// SwitchOutputs optional list of DS2408 channels 1..8 that are used as output, by ROMId.
+	// Output channels can be switched with an action.
+	SwitchOutputs map[string][]int `yaml:"switchOutputs,omitempty"`
+
+	// AnalogInputs optional linear scaling of DS2450 inputs, by ROMId and channel A-D
+	AnalogInputs map[string]map[string]AnalogConfig `yaml:"analogInputs,omitempty"`
+
+	// DS2438Profiles optional profile of DS2438 based sensors, by ROMId.
+	// Use "hih" for HIH-series humidity sensors to compute the relative humidity.
+	DS2438Profiles map[string]string `yaml:"ds2438Profiles,omitempty"`
+
+	// DS2438SenseResistors optional sense resistor in Ohm of DS2438 current measurements,
+	// by ROMId. The default is the 0.05 Ohm of the DS2438 reference circuit.
+	DS2438SenseResistors map[string]float64 `yaml:"ds2438SenseResistors,omitempty"`
+
+	// KeyReader optional presence mode for DS1990A iButton keys.
+	// When set, keys are reported as events of a reader Thing instead of becoming Things.
+	KeyReader *KeyReaderConfig `yaml:"keyReader,omitempty"`
+
+	// Calibration optional calibration of sensor values, by ROMId and attribute name, eg Temperature.
+	// Calibrations recorded with the calibrate action are kept in the binding state and take
+	// precedence.
+	Calibration map[string]map[string]CalibrationConfig `yaml:"calibration,omitempty"`
+
+	// Plausibility optional override of the plausibility checks of sensor readings
+	Plausibility PlausibilityConfig `yaml:"plausibility,omitempty"`
+
+	// VirtualThings optional Things with sensors that are computed from other sensors
+	VirtualThings []VirtualThingConfig `yaml:"virtualThings,omitempty"`
+
+	// Groups optional composite Things that aggregate the sensors of member devices, eg a room
+	Groups []GroupConfig `yaml:"groups,omitempty"`
+
+	// SplitThings optional split of multisensors into a parent Thing and a child Thing for
+	// each measured quantity, by model, eg EDS0068, or by ROMId. ROMId takes precedence.
+	SplitThings map[string]SplitConfig `yaml:"splitThings,omitempty"`
+
+	// Language optional default language of TD titles and descriptions, eg "nl".
+	// Translations in other languages are included in the TD titles and descriptions maps.
+	// Default is "en".
+	Language string `yaml:"language,omitempty"`
+
+	// Translations optional translations of TD titles and descriptions, by language and English text.
+	// These add to or replace the translations that are shipped with the binding.
+	Translations map[string]map[string]string `yaml:"translations,omitempty"`
+
+	// StrictTDValidation refuses to publish TDs that fail validation.
+	// Default is to publish them and log the violations.
+	StrictTDValidation bool `yaml:"strictTDValidation,omitempty"`
+
+	// HTTPAddress optional address of the embedded WoT HTTP server, eg "localhost:8480".
+	// The server has no authentication and is intended for local tools. Default "" is disabled.
+	HTTPAddress string `yaml:"httpAddress,omitempty"`
+
+	// StoreFolder optional folder of the binding state file.
+	// Default is the stores folder of the hub.
+	StoreFolder string `yaml:"storeFolder,omitempty"`
+}
+
+// KeyReaderConfig with the iButton reader Thing and the known keys
+type KeyReaderConfig struct {
+	// ReaderID is the thing ID of the reader. Default is "keyReader".
+	ReaderID string `yaml:"readerID,omitempty"`
+
+	// Title of the reader Thing, eg "Workshop door"
+	Title string `yaml:"title,omitempty"`
+
+	// Keys maps the ROMId of known keys to the name of a person or token
+	Keys map[string]string `yaml:"keys,omitempty"`
+}
+
+// CounterConfig with the scaling of a pulse counter
+type CounterConfig struct {
+	// Title optional title of the counter, eg "Water meter"
+	Title string `yaml:"title,omitempty"`
+
+	// PulsesPerUnit is the number of pulses per unit of the total, eg 1000 pulses per m3.
+	// Default is 1
+	PulsesPerUnit float64 `yaml:"pulsesPerUnit,omitempty"`
+
+	// Unit of the total, eg "m3". Default is the pulse count.
+	Unit string `yaml:"unit,omitempty"`
+
+	// Offset in units that is added to the total, eg the total of a replaced meter
+	Offset float64 `yaml:"offset,omitempty"`
+
+	// Decimals of the total and rate. Default is 0.
+	Decimals int `yaml:"decimals,omitempty"`
+}
+
+// AnalogConfig with the linear scaling of an A/D converter input from volts to engineering units.
+// For example, a 4-20mA transmitter over a 250 Ohm resistor for 0-10 bar has
+// rawLow 1.0, rawHigh 5.0, low 0 and high 10.
+type AnalogConfig struct {
+	// Title optional title of the input, eg "Tank level"
+	Title string `yaml:"title,omitempty"`
+
+	// Unit of the scaled value, eg "bar". Default is volt.
+	Unit string `yaml:"unit,omitempty"`
+
+	// RawLow and RawHigh are the input voltages that correspond to Low and High
+	RawLow  float64 `yaml:"rawLow"`
+	RawHigh float64 `yaml:"rawHigh"`
+
+	// Low and High are the scaled values at RawLow and RawHigh
+	Low  float64 `yaml:"low"`
+	High float64 `yaml:"high"`
+
+	// Decimals optional number of decimals of the scaled value.
+	// Default is the precision of the input voltage.
+	Decimals *int `yaml:"decimals,omitempty"`
+}
+
+// PlausibilityConfig with the checks of sensor readings.
+// Readings that fail a check are not published but reported in the health event.
+type PlausibilityConfig struct {
+	// Disabled turns off the plausibility checks
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Ranges optional valid range of readings by attribute name, eg Temperature.
+	// This replaces the default range of the quantity.
+	Ranges map[string]RangeConfig `yaml:"ranges,omitempty"`
+
+	// MaxChange optional maximum change of a reading between polls by attribute name.
+	// A larger change is accepted when the next poll confirms it.
+	MaxChange map[string]float64 `yaml:"maxChange,omitempty"`
+
+	// StuckHours optional number of hours after which a reading that doesn't change is
+	// considered stuck. Default 0 is no stuck detection.
+	StuckHours float64 `yaml:"stuckHours,omitempty"`
+}
+
+// RangeConfig with the valid range of a reading
+type RangeConfig struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// CalibrationConfig with the correction of a sensor value.
+// The calibrated value is raw*gain + offset, unless a two-point calibration is set.
+type CalibrationConfig struct {
+	// Offset added to the value after applying the gain
+	Offset float64 `yaml:"offset,omitempty" json:"offset,omitempty"`
+
+	// Gain to multiply the value with. Default is 1.
+	Gain float64 `yaml:"gain,omitempty" json:"gain,omitempty"`
+
+	// Optional two-point calibration. The raw values RawLow and RawHigh are the sensor readings
+	// of the reference values RefLow and RefHigh.
+	RawLow  float64 `yaml:"rawLow,omitempty" json:"rawLow,omitempty"`
+	RawHigh float64 `yaml:"rawHigh,omitempty" json:"rawHigh,omitempty"`
+	RefLow  float64 `yaml:"refLow,omitempty" json:"refLow,omitempty"`
+	RefHigh float64 `yaml:"refHigh,omitempty" json:"refHigh,omitempty"`
+}
+
+// SplitConfig with the child Things of a multisensor that is split
+type SplitConfig struct {
+	// Children optional title and location of the child Things, by quantity, eg Temperature.
+	// Only the listed quantities are split. Default is a child Thing for each measured
+	// quantity with the sensor title.
+	Children map[string]ChildThingConfig `yaml:"children,omitempty"`
+}
+
+// ChildThingConfig with the metadata of a child Thing
+type ChildThingConfig struct {
+	// Title of the child Thing, eg "Attic light level"
+	Title string `yaml:"title,omitempty"`
+
+	// Location of the sensor, eg "Attic"
+	Location string `yaml:"location,omitempty"`
+}
+
+// VirtualThingConfig describes a Thing whose sensor values are computed by the binding
+type VirtualThingConfig struct {
+	// ThingID of the virtual Thing
+	ThingID string `yaml:"thingID"`
+	// Title of the virtual Thing
+	Title string `yaml:"title,omitempty"`
+	// DeviceType of the virtual Thing. Default is "sensor".
+	DeviceType string `yaml:"deviceType,omitempty"`
+	// Sensors that are computed after each poll
+	Sensors []VirtualSensorConfig `yaml:"sensors"`
+}
+
+// VirtualSensorConfig describes a sensor that is computed from other sensor values
+type VirtualSensorConfig struct {
+	// ID of the sensor event
+	ID string `yaml:"id"`
+	// Title of the sensor
+	Title string `yaml:"title,omitempty"`
+	// VocabType optional sensor type from the vocabulary, eg "temperature".
+	VocabType string `yaml:"vocabType,omitempty"`
+	// Unit of the computed value
+	Unit string `yaml:"unit,omitempty"`
+	// Decimals of the computed value. Default is 0.
+	Decimals int `yaml:"decimals,omitempty"`
+	// Expression to compute the value. Variables are {ROMId}.{attribute}, eg
+	// "2A000003BB170B28.Temperature - 49000001BCEAD428.Temperature"
+	Expression string `yaml:"expression"`
+}
+
+// GroupConfig describes a composite Thing that aggregates the sensors of its member devices
+type GroupConfig struct {
+	// ThingID of the group Thing
+	ThingID string `yaml:"thingID"`
+	// Title of the group Thing
+	Title string `yaml:"title,omitempty"`
+	// DeviceType of the group Thing. Default is "sensor".
+	DeviceType string `yaml:"deviceType,omitempty"`
+	// Members ROMIds of the member devices
+	Members []string `yaml:"members"`
+	// Aggregates the aggregation functions avg, min and max, by attribute name, eg Temperature
+	Aggregates map[string][]string `yaml:"aggregates"`
+	// Limits optional alarm limits by attribute name. The group alarm is active when a member
+	// reading is outside its limits, or when a member's hardware alarm is active.
+	Limits map[string]RangeConfig `yaml:"limits,omitempty"`
 }
 
 // NewBindingConfig returns a OWServerBindingConfig with default values
@@ -47,5 +284,7 @@ func NewBindingConfig() OWServerBindingConfig {
 	cfg.TDInterval = 3600 * 12
 	cfg.PollInterval = 60
 	cfg.RepublishInterval = 3600
+	cfg.UnavailablePolls = 3
+	cfg.RetireHours = 24 * 7
 	return cfg
 }
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BindingState holds the binding data that is changed at runtime and survives a restart
+type BindingState struct {
+	// Calibration recorded with the calibrate action, by ROMId and attribute name
+	Calibration map[string]map[string]CalibrationConfig `json:"calibration,omitempty"`
+
+	// DeviceInfo user assigned title, location and description, by ROMId
+	DeviceInfo map[string]DeviceInfo `json:"deviceInfo,omitempty"`
+
+	// ThingIDs last used thing ID, by ROMId
+	ThingIDs map[string]string `json:"thingIDs,omitempty"`
+
+	// PreviousThingIDs maps thing IDs that are no longer used to their ROMId
+	PreviousThingIDs map[string]string `json:"previousThingIDs,omitempty"`
+
+	// Replacements maps the ROMId of a replaced device to the ROMId of its replacement
+	Replacements map[string]string `json:"replacements,omitempty"`
+
+	// CounterOffsets carried over from a replaced device, by ROMId and counter name
+	CounterOffsets map[string]map[string]float64 `json:"counterOffsets,omitempty"`
+
+	// Counters with the pulses counted so far, by ROMId and counter name
+	Counters map[string]map[string]*CounterState `json:"counters,omitempty"`
+
+	// Settings last known writable settings, such as alarm thresholds, by node ID and attribute ID.
+	// These are copied to the device that replaces it.
+	Settings map[string]map[string]string `json:"settings,omitempty"`
+
+	// Presence of the nodes reported by the gateway, by node ID
+	Presence map[string]*NodePresence `json:"presence,omitempty"`
+}
+
+// NewBindingState returns an empty binding state
+func NewBindingState() *BindingState {
+	return &BindingState{
+		Calibration:      make(map[string]map[string]CalibrationConfig),
+		DeviceInfo:       make(map[string]DeviceInfo),
+		ThingIDs:         make(map[string]string),
+		PreviousThingIDs: make(map[string]string),
+		Replacements:     make(map[string]string),
+		CounterOffsets:   make(map[string]map[string]float64),
+		Counters:         make(map[string]map[string]*CounterState),
+		Settings:         make(map[string]map[string]string),
+		Presence:         make(map[string]*NodePresence),
+	}
+}
+
+// statePath returns the path of the binding state file, or "" if no store folder is configured
+func (binding *OWServerBinding) statePath() string {
+	if binding.Config.StoreFolder == "" {
+		return ""
+	}
+	return path.Join(binding.Config.StoreFolder, binding.Config.BindingID+".json")
+}
+
+// LoadState loads the binding state from the state file.
+// A missing state file is not an error.
+func (binding *OWServerBinding) LoadState() error {
+	statePath := binding.statePath()
+	if statePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	state := NewBindingState()
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		logrus.Errorf("state file '%s' is invalid: %s", statePath, err)
+		return err
+	}
+	binding.mu.Lock()
+	binding.state = state
+	binding.indexReplacements()
+	binding.mu.Unlock()
+	return nil
+}
+
+// SaveState writes the binding state to the state file
+func (binding *OWServerBinding) SaveState() error {
+	statePath := binding.statePath()
+	if statePath == "" {
+		return nil
+	}
+	binding.saveMu.Lock()
+	defer binding.saveMu.Unlock()
+	binding.mu.Lock()
+	data, err := json.MarshalIndent(binding.state, "", "  ")
+	binding.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(binding.Config.StoreFolder, 0700)
+	if err == nil {
+		// write and rename to avoid a partial state file
+		tmpPath := statePath + ".tmp"
+		err = os.WriteFile(tmpPath, data, 0600)
+		if err == nil {
+			err = os.Rename(tmpPath, statePath)
+		}
+	}
+	if err != nil {
+		logrus.Errorf("unable to save state to '%s': %s", statePath, err)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// ActionCalibrate is the binding action that records a reference value to calibrate a sensor
+const ActionCalibrate = "calibrate"
+
+// CalibrateArgs is the input of the calibrate action
+type CalibrateArgs struct {
+	// ThingID of the device to calibrate
+	ThingID string `json:"thingID"`
+	// Attribute to calibrate, eg Temperature
+	Attr string `json:"attr"`
+	// Reference is the true value of the measured quantity
+	Reference float64 `json:"reference"`
+}
+
+// Calibrate returns the calibrated value of a raw sensor value
+func (cal CalibrationConfig) Calibrate(raw float64) float64 {
+	if cal.RawHigh != cal.RawLow {
+		return cal.RefLow + (raw-cal.RawLow)*(cal.RefHigh-cal.RefLow)/(cal.RawHigh-cal.RawLow)
+	}
+	gain := cal.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return raw*gain + cal.Offset
+}
+
+// String describes the calibration for use in the TD
+func (cal CalibrationConfig) String() string {
+	if cal.RawHigh != cal.RawLow {
+		return fmt.Sprintf("Calibrated with two points: %g=%g, %g=%g",
+			cal.RawLow, cal.RefLow, cal.RawHigh, cal.RefHigh)
+	}
+	gain := cal.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return fmt.Sprintf("Calibrated with gain %g and offset %g", gain, cal.Offset)
+}
+
+// getCalibration returns the calibration of a node attribute.
+// Calibrations recorded in the binding state take precedence over the configuration.
+func (binding *OWServerBinding) getCalibration(nodeID, attrID string) (cal CalibrationConfig, found bool) {
+	cal, found = binding.state.Calibration[nodeID][attrID]
+	if !found {
+		cal, found = binding.Config.Calibration[binding.configID(nodeID)][attrID]
+	}
+	return cal, found
+}
+
+// ApplyCalibration calibrates the numeric sensor values of the node.
+// The raw value is calibrated before it is rounded.
+func (binding *OWServerBinding) ApplyCalibration(node *eds.OneWireNode) {
+	for attrID, attr := range node.Attr {
+		cal, found := binding.getCalibration(node.NodeID, attrID)
+		if !found {
+			continue
+		}
+		raw, err := strconv.ParseFloat(attr.RawValue, 64)
+		if err != nil {
+			continue
+		}
+		value := cal.Calibrate(raw)
+		if attr.Decimals >= 0 {
+			attr.Value = eds.RoundValue(value, attr.Decimals)
+		} else {
+			attr.Value = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		attr.Description = cal.String()
+		node.Attr[attrID] = attr
+	}
+}
+
+// HandleCalibrateAction records a reference value of a sensor and computes the offset
+// that makes the sensor report the reference value. The gain is kept.
+func (binding *OWServerBinding) HandleCalibrateAction(data []byte) error {
+	var args CalibrateArgs
+	err := json.Unmarshal(data, &args)
+	if err != nil {
+		return fmt.Errorf("invalid calibrate arguments: %w", err)
+	}
+	args.ThingID = binding.NodeIDOf(args.ThingID)
+	binding.mu.Lock()
+	node, found := binding.nodes[args.ThingID]
+	var attr eds.OneWireAttr
+	if found {
+		attr, found = node.Attr[args.Attr]
+	}
+	if !found {
+		binding.mu.Unlock()
+		return fmt.Errorf("unknown attribute '%s' of thing '%s'", args.Attr, args.ThingID)
+	}
+	raw, err := strconv.ParseFloat(attr.RawValue, 64)
+	if err != nil {
+		binding.mu.Unlock()
+		return fmt.Errorf("attribute '%s' of thing '%s' is not numeric", args.Attr, args.ThingID)
+	}
+	// calibration of a child Thing applies to the parent device
+	if node.ParentID != "" {
+		args.ThingID = node.ParentID
+	}
+	cal, _ := binding.getCalibration(args.ThingID, args.Attr)
+	// an offset calibration replaces a two-point calibration
+	cal.RawLow, cal.RawHigh, cal.RefLow, cal.RefHigh = 0, 0, 0, 0
+	cal.Offset = 0
+	// the new offset corrects the difference between the reference and the gain adjusted value
+	cal.Offset = args.Reference - cal.Calibrate(raw)
+	nodeCal, found := binding.state.Calibration[args.ThingID]
+	if !found {
+		nodeCal = make(map[string]CalibrationConfig)
+		binding.state.Calibration[args.ThingID] = nodeCal
+	}
+	nodeCal[args.Attr] = cal
+	binding.mu.Unlock()
+
+	logrus.Infof("Calibrated '%s' of thing '%s': %s", args.Attr, args.ThingID, cal)
+	return binding.SaveState()
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"github.com/hiveot/hub/api/go/vocab"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// Properties of child Things
+const (
+	// PropNameParent is the property with the thing ID of the parent of a child Thing
+	PropNameParent = "parent"
+	// PropNameLocation is the property with the location of a child Thing
+	PropNameLocation = "location"
+)
+
+// ChildThingID returns the thing ID of the child Thing of a quantity of a split node
+func ChildThingID(parentID string, quantity string) string {
+	return parentID + "-" + quantity
+}
+
+// getSplitConfig returns the split configuration of a node, by ROMId or by model
+func (binding *OWServerBinding) getSplitConfig(node *eds.OneWireNode) (cfg SplitConfig, found bool) {
+	cfg, found = binding.Config.SplitThings[binding.configID(node.NodeID)]
+	if !found && node.Model != "" {
+		cfg, found = binding.Config.SplitThings[node.Model]
+	}
+	return cfg, found
+}
+
+// isMeasurement returns true if the attribute is a measured quantity, eg temperature.
+// Health, counters and their rates, and boolean states such as relays, LEDs and switch
+// channels are not measurements.
+func isMeasurement(attrID string, attr eds.OneWireAttr) bool {
+	return attr.IsSensor && !attr.IsCounter && attr.DataType == vocab.WoTDataTypeNumber &&
+		attr.VocabType != eds.VocabCounterRate && attrID != "Health"
+}
+
+// SplitNode moves the measured quantities of a multisensor node into a child node each,
+// together with their alarms. If the split configuration lists children then only those
+// quantities are split. The parent keeps the remaining attributes and actions. Writes to
+// child attributes are routed to the parent device.
+// This returns the child nodes, or nil if the node is not configured to be split.
+func (binding *OWServerBinding) SplitNode(node *eds.OneWireNode) []*eds.OneWireNode {
+	cfg, found := binding.getSplitConfig(node)
+	if !found {
+		return nil
+	}
+	children := make([]*eds.OneWireNode, 0)
+	for attrID, attr := range node.Attr {
+		childCfg, isListed := cfg.Children[attrID]
+		if len(cfg.Children) > 0 && (!isListed || !attr.IsSensor) {
+			continue
+		} else if len(cfg.Children) == 0 && !isMeasurement(attrID, attr) {
+			continue
+		}
+		child := &eds.OneWireNode{
+			DeviceType:  vocab.DeviceTypeSensor,
+			NodeID:      ChildThingID(node.NodeID, attrID),
+			Model:       node.Model,
+			Name:        childCfg.Title,
+			Description: attr.Name + " of " + node.Name,
+			Attr:        map[string]eds.OneWireAttr{attrID: attr},
+			Alarms:      make(map[string]*eds.OneWireAlarm),
+			ParentID:    node.NodeID,
+		}
+		if child.Name == "" {
+			child.Name = attr.Name
+		}
+		child.Attr[PropNameParent] = eds.OneWireAttr{
+			ID: PropNameParent, Name: "Parent Thing", DataType: vocab.WoTDataTypeString,
+			Value: binding.formatThingID(node)}
+		if childCfg.Location != "" {
+			child.Attr[PropNameLocation] = eds.OneWireAttr{
+				ID: PropNameLocation, Name: "Location", DataType: vocab.WoTDataTypeString, Value: childCfg.Location}
+		}
+		delete(node.Attr, attrID)
+		children = append(children, child)
+
+		// alarm states and thresholds of the quantity move with the sensor
+		for alarmAttrID, alarmAttr := range node.Attr {
+			// match the affordance name, as renamed attributes such as the DS18B20 TH and TL
+			// registers keep their EDS ID
+			if quantity, isAlarm := eds.AlarmQuantity(alarmAttrID); isAlarm && quantity == attrID {
+				child.Attr[alarmAttrID] = alarmAttr
+				delete(node.Attr, alarmAttrID)
+			}
+		}
+		for alarmID, alarm := range node.Alarms {
+			if alarm.Quantity == attrID {
+				child.Alarms[alarmID] = alarm
+				delete(node.Alarms, alarmID)
+			}
+		}
+	}
+	return children
+}
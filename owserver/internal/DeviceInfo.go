@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/hub/api/go/vocab"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// Writable properties with the user assigned title and description of a device.
+// The location uses PropNameLocation.
+const (
+	PropNameTitle       = "title"
+	PropNameDescription = "description"
+)
+
+// DeviceInfo holds the user assigned title, location and description of a device
+type DeviceInfo struct {
+	Title       string `json:"title,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// isDeviceInfo returns true if the property holds user assigned device info
+func isDeviceInfo(propName string) bool {
+	return propName == PropNameTitle || propName == PropNameLocation || propName == PropNameDescription
+}
+
+// ApplyDeviceInfo adds the writable title, location and description properties to a device
+// node and replaces its name and description with those assigned by the user.
+// This must be called with the lock held.
+func (binding *OWServerBinding) ApplyDeviceInfo(node *eds.OneWireNode) {
+	info := binding.state.DeviceInfo[node.NodeID]
+	if info.Title != "" {
+		node.Name = info.Title
+	}
+	if info.Description != "" {
+		node.Description = info.Description
+	}
+	// the location of child Things can also be set in the configuration
+	location := info.Location
+	if location == "" {
+		location = node.Attr[PropNameLocation].Value
+	}
+	node.Attr[PropNameTitle] = eds.OneWireAttr{ID: PropNameTitle, Name: "Title",
+		VocabType: vocab.VocabName, DataType: vocab.WoTDataTypeString, Writable: true, Value: node.Name}
+	node.Attr[PropNameLocation] = eds.OneWireAttr{ID: PropNameLocation, Name: "Location",
+		DataType: vocab.WoTDataTypeString, Writable: true, Value: location}
+	node.Attr[PropNameDescription] = eds.OneWireAttr{ID: PropNameDescription, Name: "Description",
+		DataType: vocab.WoTDataTypeString, Writable: true, Value: node.Description}
+}
+
+// SetDeviceInfo stores a user assigned title, location or description of a device in the
+// binding state. An empty value restores the default.
+//
+//	nodeID is the ROMId of the device, or the ID of a child Thing
+//	propName is one of PropNameTitle, PropNameLocation or PropNameDescription
+//	data is the new value as plain text or JSON string
+func (binding *OWServerBinding) SetDeviceInfo(nodeID string, propName string, data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		value = string(data)
+	}
+	value = strings.TrimSpace(value)
+
+	binding.mu.Lock()
+	info := binding.state.DeviceInfo[nodeID]
+	switch propName {
+	case PropNameTitle:
+		info.Title = value
+	case PropNameLocation:
+		info.Location = value
+	case PropNameDescription:
+		info.Description = value
+	default:
+		binding.mu.Unlock()
+		return fmt.Errorf("'%s' is not a device info property", propName)
+	}
+	if info == (DeviceInfo{}) {
+		delete(binding.state.DeviceInfo, nodeID)
+	} else {
+		binding.state.DeviceInfo[nodeID] = info
+	}
+	binding.mu.Unlock()
+
+	logrus.Infof("Set %s of node '%s' to '%s'", propName, nodeID, value)
+	return binding.SaveState()
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// Aggregation functions of group Things
+const (
+	AggregateAvg = "avg"
+	AggregateMin = "min"
+	AggregateMax = "max"
+)
+
+// Attributes of group Things
+const (
+	PropNameDegraded         = "degraded"
+	PropNameAvailableMembers = "availableMembers"
+	EventNameGroupAlarm      = "groupAlarm"
+)
+
+// aggregateTitles are the titles of the aggregation functions
+var aggregateTitles = map[string]string{
+	AggregateAvg: "Average",
+	AggregateMin: "Minimum",
+	AggregateMax: "Maximum",
+}
+
+// aggregate returns the result of an aggregation function over the member values
+func aggregate(function string, values []float64) (result float64, err error) {
+	switch function {
+	case AggregateAvg:
+		for _, value := range values {
+			result += value
+		}
+		result /= float64(len(values))
+	case AggregateMin:
+		result = math.Inf(1)
+		for _, value := range values {
+			result = math.Min(result, value)
+		}
+	case AggregateMax:
+		result = math.Inf(-1)
+		for _, value := range values {
+			result = math.Max(result, value)
+		}
+	default:
+		err = fmt.Errorf("unknown aggregation function '%s'", function)
+	}
+	return result, err
+}
+
+// exceedsLimit returns true if a member reading is outside the group limit of the quantity
+func exceedsLimit(value float64, limit RangeConfig, hasLimit bool) bool {
+	return hasLimit && (value < limit.Min || value > limit.Max)
+}
+
+// CreateGroupNodes computes the configured group Things from the values of their member
+// devices, and returns a node for each group.
+// Each group has the configured aggregates of the member values, an alarm that is active
+// when any member exceeds the group limit, and is degraded when members are unavailable.
+// Aggregates without member readings are included without a value so the TD stays the same.
+// A member that misses a poll keeps its last reading until it is reported unavailable.
+// This must be called with the lock held.
+func (binding *OWServerBinding) CreateGroupNodes(nodes []*eds.OneWireNode) []*eds.OneWireNode {
+	if len(binding.Config.Groups) == 0 {
+		return nil
+	}
+	nodeMap := make(map[string]*eds.OneWireNode)
+	for _, node := range binding.nodes {
+		nodeMap[binding.configID(node.NodeID)] = node
+		nodeMap[node.NodeID] = node
+	}
+	for _, node := range nodes {
+		// groups keep working when a member is replaced
+		nodeMap[binding.configID(node.NodeID)] = node
+		nodeMap[node.NodeID] = node
+	}
+
+	groupNodes := make([]*eds.OneWireNode, 0, len(binding.Config.Groups))
+	for _, group := range binding.Config.Groups {
+		deviceType := group.DeviceType
+		if deviceType == "" {
+			deviceType = vocab.DeviceTypeSensor
+		}
+		gNode := &eds.OneWireNode{
+			NodeID:      group.ThingID,
+			Name:        group.Title,
+			Description: "Group of " + strings.Join(group.Members, ", "),
+			DeviceType:  deviceType,
+			Attr:        make(map[string]eds.OneWireAttr),
+			Alarms:      make(map[string]*eds.OneWireAlarm),
+		}
+		members := make([]*eds.OneWireNode, 0, len(group.Members))
+		for _, memberID := range group.Members {
+			if member, found := nodeMap[memberID]; found && !binding.isUnavailable(member.NodeID) {
+				members = append(members, member)
+			}
+		}
+		degraded := len(members) < len(group.Members)
+		alarm := false
+
+		attrIDs := make([]string, 0, len(group.Aggregates))
+		for attrID := range group.Aggregates {
+			attrIDs = append(attrIDs, attrID)
+		}
+		sort.Strings(attrIDs)
+		for _, attrID := range attrIDs {
+			limit, hasLimit := group.Limits[attrID]
+			values := make([]float64, 0, len(members))
+			// the quantity is described by a member that reported it, also if it is unavailable
+			memberAttr := eds.OneWireAttr{Name: attrID, Decimals: -1}
+			for _, memberID := range group.Members {
+				if member, found := nodeMap[memberID]; found {
+					if attr, found := member.Attr[attrID]; found {
+						memberAttr = attr
+						break
+					}
+				}
+			}
+			for _, member := range members {
+				attr, found := member.Attr[attrID]
+				if !found || attr.Rejected {
+					// a member without a plausible reading doesn't contribute
+					degraded = true
+					continue
+				}
+				value, err := strconv.ParseFloat(attr.Value, 64)
+				if err != nil {
+					degraded = true
+					continue
+				}
+				values = append(values, value)
+				alarm = alarm || exceedsLimit(value, limit, hasLimit)
+			}
+			for _, function := range group.Aggregates[attrID] {
+				result, err := aggregate(function, values)
+				if err != nil {
+					logrus.Warningf("group '%s': %s", group.ThingID, err)
+					continue
+				}
+				// without member readings the aggregate has no value
+				value := ""
+				if len(values) > 0 {
+					value = strconv.FormatFloat(result, 'f', -1, 64)
+					if memberAttr.Decimals >= 0 {
+						value = eds.RoundValue(result, memberAttr.Decimals)
+					}
+				}
+				id := attrID + strings.ToUpper(function[:1]) + function[1:]
+				gNode.Attr[id] = eds.OneWireAttr{
+					ID:        id,
+					Name:      aggregateTitles[function] + " " + memberAttr.Name,
+					VocabType: memberAttr.VocabType,
+					Unit:      memberAttr.Unit,
+					Value:     value,
+					IsSensor:  true,
+					DataType:  vocab.WoTDataTypeNumber,
+					Decimals:  memberAttr.Decimals,
+				}
+			}
+		}
+		gNode.Attr[EventNameGroupAlarm] = eds.OneWireAttr{
+			ID:          EventNameGroupAlarm,
+			Name:        "Group alarm",
+			VocabType:   vocab.VocabAlarmState,
+			Value:       boolValue(alarm),
+			IsSensor:    true,
+			DataType:    vocab.WoTDataTypeBool,
+			Description: "A member exceeds the group limit",
+		}
+		gNode.Attr[PropNameDegraded] = eds.OneWireAttr{
+			ID:          PropNameDegraded,
+			Name:        "Degraded",
+			Value:       boolValue(degraded),
+			DataType:    vocab.WoTDataTypeBool,
+			Description: "Members are unavailable or have no valid reading",
+		}
+		gNode.Attr[PropNameAvailableMembers] = eds.OneWireAttr{
+			ID:       PropNameAvailableMembers,
+			Name:     "Available members",
+			Value:    strconv.Itoa(len(members)),
+			DataType: vocab.WoTDataTypeInteger,
+			Min:      0,
+			Max:      float64(len(group.Members)),
+		}
+		groupNodes = append(groupNodes, gNode)
+	}
+	return groupNodes
+}
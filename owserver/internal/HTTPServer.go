@@ -0,0 +1,536 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiveot/hub/api/go/hubapi"
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/hiveot/hub/lib/thing"
+	"github.com/hiveot/hub/pkg/pubsub"
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// HTTPThingsPath is the path under which the HTTP server serves the Things
+const HTTPThingsPath = "/things"
+
+// HTTPLongPollTimeout is the time a long-poll request waits for an event
+const HTTPLongPollTimeout = 30 * time.Second
+
+// WoT operation types used in the TD forms
+const (
+	OpReadProperty       = "readproperty"
+	OpWriteProperty      = "writeproperty"
+	OpObserveProperty    = "observeproperty"
+	OpReadAllProperties  = "readallproperties"
+	OpInvokeAction       = "invokeaction"
+	OpSubscribeEvent     = "subscribeevent"
+	OpSubscribeAllEvents = "subscribeallevents"
+)
+
+// subscription receives the events of a Thing for a SSE or long-poll request
+type subscription struct {
+	thingID string
+	// event name, or "" for all events
+	name string
+	// observe the property with the name instead of the event
+	observe bool
+	events  chan thingEvent
+}
+
+// thingEvent is an event or property value that is sent to subscribers
+type thingEvent struct {
+	name string
+	data json.RawMessage
+}
+
+// HTTPServer serves the Things of the binding using the W3C WoT HTTP binding.
+// TDs include forms to read properties, invoke actions, and observe properties and
+// subscribe to events using server-sent events (SSE) or long-polling.
+// The server has no authentication and is intended for local tools on a trusted network.
+type HTTPServer struct {
+	binding  *OWServerBinding
+	address  string
+	server   *http.Server
+	listener net.Listener
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]bool
+}
+
+// eventTee passes published events to the HTTP server subscribers
+type eventTee struct {
+	pubsub.IDevicePubSub
+	server *HTTPServer
+}
+
+// PubEvent publishes the event to the hub and to the HTTP subscribers
+func (tee *eventTee) PubEvent(ctx context.Context, thingID, name string, value []byte) error {
+	tee.server.notify(thingID, name, value)
+	if tee.IDevicePubSub == nil {
+		return nil
+	}
+	return tee.IDevicePubSub.PubEvent(ctx, thingID, name, value)
+}
+
+// SubAction subscribes to actions from the hub, if connected
+func (tee *eventTee) SubAction(ctx context.Context, thingID, name string, handler func(action *thing.ThingValue)) error {
+	if tee.IDevicePubSub == nil {
+		return nil
+	}
+	return tee.IDevicePubSub.SubAction(ctx, thingID, name, handler)
+}
+
+// Release the hub connection, if connected
+func (tee *eventTee) Release() {
+	if tee.IDevicePubSub != nil {
+		tee.IDevicePubSub.Release()
+	}
+}
+
+// jsonValue returns the value as JSON. Values that are not valid JSON are strings.
+func jsonValue(value string) json.RawMessage {
+	if value != "" && json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// attrValueJSON returns the JSON value of an attribute according to its data type
+func attrValueJSON(attr eds.OneWireAttr) json.RawMessage {
+	switch attr.DataType {
+	case vocab.WoTDataTypeBool:
+		return json.RawMessage(strconv.FormatBool(ValueAsBool([]byte(attr.Value))))
+	case vocab.WoTDataTypeNumber, vocab.WoTDataTypeInteger:
+		if _, err := strconv.ParseFloat(attr.Value, 64); err != nil {
+			return json.RawMessage("null")
+		}
+		return json.RawMessage(attr.Value)
+	case vocab.WoTDataTypeObject, vocab.WoTDataTypeArray:
+		return jsonValue(attr.Value)
+	}
+	data, _ := json.Marshal(attr.Value)
+	return data
+}
+
+// isProperty returns true if the attribute is a property in the TD
+func isProperty(attr eds.OneWireAttr) bool {
+	return !attr.IsSensor && !attr.IsActuator
+}
+
+// notify sends a published event to the matching subscriptions.
+// Subscribers that can't keep up miss events.
+func (svr *HTTPServer) notify(thingID, name string, value []byte) {
+	if name == hubapi.EventNameTD {
+		return
+	}
+	// the properties event holds a map of changed property values
+	var props map[string][]byte
+	data := jsonValue(string(value))
+	if name == hubapi.EventNameProperties {
+		_ = json.Unmarshal(value, &props)
+		values := make(map[string]json.RawMessage, len(props))
+		for propName, propValue := range props {
+			values[propName] = jsonValue(string(propValue))
+		}
+		data, _ = json.Marshal(values)
+	}
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	for sub := range svr.subscriptions {
+		if sub.thingID != thingID {
+			continue
+		}
+		var ev thingEvent
+		if sub.observe {
+			propValue, found := props[sub.name]
+			if !found {
+				continue
+			}
+			ev = thingEvent{name: sub.name, data: jsonValue(string(propValue))}
+		} else if sub.name == "" || sub.name == name {
+			ev = thingEvent{name: name, data: data}
+		} else {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe adds a subscription for the events of a Thing
+func (svr *HTTPServer) subscribe(thingID, name string, observe bool) *subscription {
+	sub := &subscription{thingID: thingID, name: name, observe: observe, events: make(chan thingEvent, 16)}
+	svr.mu.Lock()
+	svr.subscriptions[sub] = true
+	svr.mu.Unlock()
+	return sub
+}
+
+// unsubscribe removes a subscription
+func (svr *HTTPServer) unsubscribe(sub *subscription) {
+	svr.mu.Lock()
+	delete(svr.subscriptions, sub)
+	svr.mu.Unlock()
+}
+
+// getNode returns a copy of the node of a Thing, so it can be read without holding the lock
+func (svr *HTTPServer) getNode(thingID string) (node *eds.OneWireNode, found bool) {
+	nodeID := svr.binding.NodeIDOf(thingID)
+	svr.binding.mu.Lock()
+	defer svr.binding.mu.Unlock()
+	polledNode, found := svr.binding.nodes[nodeID]
+	if !found {
+		return nil, false
+	}
+	nodeCopy := *polledNode
+	nodeCopy.Attr = make(map[string]eds.OneWireAttr, len(polledNode.Attr))
+	for attrID, attr := range polledNode.Attr {
+		nodeCopy.Attr[attrID] = attr
+	}
+	return &nodeCopy, true
+}
+
+// getTD returns the TD of a Thing without forms
+func (svr *HTTPServer) getTD(thingID string) (td *thing.TD, found bool) {
+	if thingID == svr.binding.Config.BindingID {
+		return svr.binding.CreateBindingTD(), true
+	}
+	node, found := svr.getNode(thingID)
+	if !found {
+		return nil, false
+	}
+	return svr.binding.CreateTDFromNode(node), true
+}
+
+// readProperties returns the last polled values of the properties of a Thing.
+// Properties of the binding Thing have their configured value.
+func (svr *HTTPServer) readProperties(thingID string) (values map[string]json.RawMessage, found bool) {
+	values = make(map[string]json.RawMessage)
+	if thingID == svr.binding.Config.BindingID {
+		td := svr.binding.CreateBindingTD()
+		for name, prop := range td.Properties {
+			values[name] = jsonValue(fmt.Sprint(prop.InitialValue))
+		}
+		return values, true
+	}
+	node, found := svr.getNode(thingID)
+	if !found {
+		return nil, false
+	}
+	for attrID, attr := range node.Attr {
+		if isProperty(attr) && !attr.Rejected && attr.DataType != vocab.WoTDataTypeNone {
+			values[attrID] = attrValueJSON(attr)
+		}
+	}
+	return values, true
+}
+
+// form returns a TD form of an operation
+func form(href string, op string, subprotocol string) map[string]interface{} {
+	f := map[string]interface{}{
+		"href":        href,
+		"op":          op,
+		"contentType": "application/json",
+	}
+	if subprotocol != "" {
+		f["subprotocol"] = subprotocol
+	}
+	return f
+}
+
+// eventForms returns the SSE and long-poll forms of an event operation
+func eventForms(href string, op string) []interface{} {
+	sseForm := form(href, op, "sse")
+	sseForm["contentType"] = "text/event-stream"
+	return []interface{}{sseForm, form(href, op, "longpoll")}
+}
+
+// addForms adds the HTTP forms of the server to the TD document
+//
+//	tdDoc is the serialized TD
+//	base is the URL of the server, eg http://localhost:8480/
+func addForms(tdDoc []byte, base string) ([]byte, error) {
+	var td map[string]interface{}
+	err := json.Unmarshal(tdDoc, &td)
+	if err != nil {
+		return nil, err
+	}
+	thingID, _ := td["id"].(string)
+	thingPath := strings.TrimPrefix(HTTPThingsPath, "/") + "/" + thingID
+	td["base"] = base
+	td["forms"] = append([]interface{}{form(thingPath+"/properties", OpReadAllProperties, "")},
+		eventForms(thingPath+"/events", OpSubscribeAllEvents)...)
+	props, _ := td["properties"].(map[string]interface{})
+	for name, value := range props {
+		prop, _ := value.(map[string]interface{})
+		if prop == nil {
+			continue
+		}
+		href := thingPath + "/properties/" + name
+		forms := []interface{}{form(href, OpReadProperty, "")}
+		if readOnly, _ := prop["readOnly"].(bool); !readOnly {
+			forms = append(forms, form(href, OpWriteProperty, ""))
+		}
+		forms = append(forms, eventForms(href+"/observe", OpObserveProperty)...)
+		prop["forms"] = forms
+		prop["observable"] = true
+	}
+	actions, _ := td["actions"].(map[string]interface{})
+	for name, value := range actions {
+		if action, _ := value.(map[string]interface{}); action != nil {
+			action["forms"] = []interface{}{form(thingPath+"/actions/"+name, OpInvokeAction, "")}
+		}
+	}
+	events, _ := td["events"].(map[string]interface{})
+	for name, value := range events {
+		if event, _ := value.(map[string]interface{}); event != nil {
+			event["forms"] = eventForms(thingPath+"/events/"+name, OpSubscribeEvent)
+		}
+	}
+	return json.Marshal(td)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serveTDs writes the TDs of all Things with forms
+func (svr *HTTPServer) serveTDs(w http.ResponseWriter, base string) {
+	thingIDs := []string{svr.binding.Config.BindingID}
+	svr.binding.mu.Lock()
+	for nodeID := range svr.binding.nodes {
+		thingID, found := svr.binding.thingIDs[nodeID]
+		if !found {
+			thingID = nodeID
+		}
+		thingIDs = append(thingIDs, thingID)
+	}
+	svr.binding.mu.Unlock()
+
+	tdList := make([]json.RawMessage, 0, len(thingIDs))
+	for _, thingID := range thingIDs {
+		td, found := svr.getTD(thingID)
+		if !found {
+			continue
+		}
+		tdDoc, _ := json.Marshal(td)
+		tdDoc, err := addForms(tdDoc, base)
+		if err == nil {
+			tdList = append(tdList, tdDoc)
+		}
+	}
+	data, _ := json.Marshal(tdList)
+	writeJSON(w, data)
+}
+
+// serveEvents sends the events of the subscription as server-sent events, or waits for the
+// next event when long-polling. Long-poll requests that time out return no content.
+func (svr *HTTPServer) serveEvents(w http.ResponseWriter, r *http.Request, sub *subscription) {
+	defer svr.unsubscribe(sub)
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		select {
+		case ev := <-sub.events:
+			writeJSON(w, ev.data)
+		case <-time.After(HTTPLongPollTimeout):
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+		}
+		return
+	}
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case ev := <-sub.events:
+			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// invoke passes an action or property write to the action handler of the binding.
+// The handler waits for the gateway to apply the value, so the request is accepted and
+// handled in the background.
+func (svr *HTTPServer) invoke(w http.ResponseWriter, r *http.Request, thingID string, name string) {
+	var input json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// device attributes take plain values, binding actions take the JSON input
+	data := []byte(input)
+	var text string
+	if thingID != svr.binding.Config.BindingID && json.Unmarshal(input, &text) == nil {
+		data = []byte(text)
+	}
+	action := &thing.ThingValue{
+		PublisherID: svr.binding.Config.BindingID,
+		ThingID:     thingID,
+		ID:          name,
+		Data:        data,
+	}
+	go svr.binding.HandleActionRequest(action)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ServeHTTP handles the requests of the WoT HTTP binding:
+//
+//	GET  /things                                    TDs of all Things
+//	GET  /things/{thingID}                          TD of a Thing
+//	GET  /things/{thingID}/properties               readallproperties
+//	GET  /things/{thingID}/properties/{name}        readproperty
+//	PUT  /things/{thingID}/properties/{name}        writeproperty
+//	GET  /things/{thingID}/properties/{name}/observe observeproperty
+//	POST /things/{thingID}/actions/{name}           invokeaction
+//	GET  /things/{thingID}/events                   subscribeallevents
+//	GET  /things/{thingID}/events/{name}            subscribeevent
+func (svr *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := "http://" + r.Host + "/"
+	if r.URL.Path != HTTPThingsPath && !strings.HasPrefix(r.URL.Path, HTTPThingsPath+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, HTTPThingsPath), "/")
+	if path == "" {
+		svr.serveTDs(w, base)
+		return
+	}
+	parts := strings.Split(path, "/")
+	thingID := parts[0]
+	td, found := svr.getTD(thingID)
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown thing '%s'", thingID), http.StatusNotFound)
+		return
+	}
+	kind, name := "", ""
+	if len(parts) > 1 {
+		kind = parts[1]
+	}
+	if len(parts) > 2 {
+		name = parts[2]
+	}
+	switch {
+	case kind == "" && r.Method == http.MethodGet:
+		tdDoc, _ := json.Marshal(td)
+		tdDoc, err := addForms(tdDoc, base)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, tdDoc)
+	case kind == "properties" && name == "" && r.Method == http.MethodGet:
+		values, _ := svr.readProperties(thingID)
+		data, _ := json.Marshal(values)
+		writeJSON(w, data)
+	case kind == "properties" && td.Properties[name] == nil:
+		http.Error(w, fmt.Sprintf("unknown property '%s'", name), http.StatusNotFound)
+	case kind == "properties" && len(parts) == 4 && parts[3] == "observe" && r.Method == http.MethodGet:
+		svr.serveEvents(w, r, svr.subscribe(thingID, name, true))
+	case kind == "properties" && len(parts) == 3 && r.Method == http.MethodGet:
+		values, _ := svr.readProperties(thingID)
+		value, found := values[name]
+		if !found {
+			http.Error(w, fmt.Sprintf("property '%s' has no value", name), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, value)
+	case kind == "properties" && len(parts) == 3 && r.Method == http.MethodPut:
+		if td.Properties[name].ReadOnly {
+			http.Error(w, fmt.Sprintf("property '%s' is read-only", name), http.StatusMethodNotAllowed)
+			return
+		}
+		svr.invoke(w, r, thingID, name)
+	case kind == "actions" && len(parts) == 3 && r.Method == http.MethodPost:
+		if td.Actions[name] == nil {
+			http.Error(w, fmt.Sprintf("unknown action '%s'", name), http.StatusNotFound)
+			return
+		}
+		svr.invoke(w, r, thingID, name)
+	case kind == "events" && len(parts) <= 3 && r.Method == http.MethodGet:
+		if name != "" && td.Events[name] == nil {
+			http.Error(w, fmt.Sprintf("unknown event '%s'", name), http.StatusNotFound)
+			return
+		}
+		svr.serveEvents(w, r, svr.subscribe(thingID, name, false))
+	default:
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+	}
+}
+
+// Start listening for requests
+func (svr *HTTPServer) Start() (err error) {
+	svr.listener, err = net.Listen("tcp", svr.address)
+	if err != nil {
+		return fmt.Errorf("unable to listen on '%s': %w", svr.address, err)
+	}
+	svr.server = &http.Server{Handler: svr, ReadHeaderTimeout: 10 * time.Second}
+	logrus.Infof("WoT HTTP server listening on %s", svr.listener.Addr())
+	go func() {
+		err2 := svr.server.Serve(svr.listener)
+		if err2 != nil && err2 != http.ErrServerClosed {
+			logrus.Errorf("WoT HTTP server stopped: %s", err2)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (svr *HTTPServer) Addr() string {
+	if svr.listener == nil {
+		return svr.address
+	}
+	return svr.listener.Addr().String()
+}
+
+// Stop the server and end the open subscriptions
+func (svr *HTTPServer) Stop() {
+	if svr.server != nil {
+		_ = svr.server.Close()
+	}
+}
+
+// NewHTTPServer creates the WoT HTTP server of the binding.
+// Events that the binding publishes are passed to the HTTP subscribers.
+//
+//	binding whose Things are served
+//	address to listen on, eg "localhost:8480"
+func NewHTTPServer(binding *OWServerBinding, address string) *HTTPServer {
+	svr := &HTTPServer{
+		binding:       binding,
+		address:       address,
+		subscriptions: make(map[*subscription]bool),
+	}
+	// without a hub connection the events only go to the HTTP subscribers
+	binding.pubsub = &eventTee{IDevicePubSub: binding.pubsub, server: svr}
+	return svr
+}
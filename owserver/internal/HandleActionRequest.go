@@ -2,6 +2,8 @@
 package internal
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -21,18 +23,19 @@ func (binding *OWServerBinding) HandleActionRequest(action *thing.ThingValue) {
 	// to the EDS writable property name.
 
 	// which node is this action for?
-	deviceID := action.ThingID
-
-	// lookup the action name used by the EDS
-	edsName := action.ID
-
-	// determine the value. Booleans are submitted as integers
-	actionValue := action.Data
+	if action.ThingID == binding.Config.BindingID {
+		binding.HandleBindingAction(action)
+		return
+	}
+	deviceID := binding.NodeIDOf(action.ThingID)
 
+	// actions run concurrently with polling, which replaces the nodes
+	binding.mu.Lock()
 	node, found := binding.nodes[deviceID]
 	if found {
 		attr, found = node.Attr[action.ID]
 	}
+	binding.mu.Unlock()
 	if !found {
 		logrus.Warningf("action '%s' on unknown attribute '%s'", action.ID, attr.Name)
 		return
@@ -40,11 +43,19 @@ func (binding *OWServerBinding) HandleActionRequest(action *thing.ThingValue) {
 		logrus.Warningf("action '%s' on read-only attribute '%s'", action.ID, attr.Name)
 		return
 	}
-	// TODO: type conversions needed?
-	if attr.DataType == vocab.WoTDataTypeBool {
-		//actionValue = fmt.Sprint(ValueAsInt())
+	// user assigned device info is kept by the binding and not written to the device
+	if isDeviceInfo(attr.ID) {
+		err := binding.SetDeviceInfo(node.NodeID, attr.ID, action.Data)
+		if err == nil {
+			err = binding.RefreshPropertyValues()
+		}
+		if err != nil {
+			logrus.Warningf("action '%s' failed: %s", action.ID, err)
+		}
+		return
 	}
-	err := binding.edsAPI.WriteData(deviceID, edsName, string(actionValue))
+
+	err := binding.writeAttr(node, action.ID, attr, action.Data)
 
 	// read the result
 	time.Sleep(time.Second)
@@ -58,3 +69,85 @@ func (binding *OWServerBinding) HandleActionRequest(action *thing.ThingValue) {
 		logrus.Warningf("action '%s' failed: %s", action.ID, err)
 	}
 }
+
+// writeAttr writes the value of a writable attribute to the device.
+// Child Things are written through their parent device, and values are converted to the
+// representation the EDS expects.
+//
+//	attrID is the affordance ID of the attribute, eg output1
+func (binding *OWServerBinding) writeAttr(node *eds.OneWireNode, attrID string, attr eds.OneWireAttr, value []byte) error {
+	// lookup the variable name used by the EDS
+	edsName := attr.ID
+	deviceID := node.NodeID
+
+	// child Things are written through their parent device
+	if node.ParentID != "" {
+		deviceID = node.ParentID
+		binding.mu.Lock()
+		parent, found := binding.nodes[deviceID]
+		binding.mu.Unlock()
+		if !found {
+			return fmt.Errorf("child of unknown thing '%s'", deviceID)
+		}
+		node = parent
+	}
+
+	if err := eds.ActuatorEnabled(node, attr); err != nil {
+		return fmt.Errorf("refused: %w", err)
+	}
+
+	actionValue := value
+	// Booleans are written as integers
+	if attr.DataType == vocab.WoTDataTypeBool {
+		actionValue = []byte(boolValue(ValueAsBool(value)))
+	} else if attr.DataType == vocab.WoTDataTypeNone {
+		// commands such as ClearAlarms don't take a value but the EDS needs one
+		actionValue = []byte("1")
+	}
+	if node.Family == eds.FamilyDS2408 && edsName == eds.DS2408OutputLatchState {
+		// DS2408 outputs share a single register with a bit per channel
+		return binding.writeOutput(deviceID, attrID, ValueAsBool(value))
+	}
+	var err error
+	if node.Family == eds.FamilyDS18B20 && (edsName == eds.DS18B20TH || edsName == eds.DS18B20TL) {
+		// DS18B20 alarm thresholds are stored as signed bytes
+		var thValue string
+		thValue, err = eds.DS18B20ThresholdValue(string(actionValue))
+		actionValue = []byte(thValue)
+	}
+	if err == nil {
+		err = binding.edsAPI.WriteData(deviceID, edsName, string(actionValue))
+	}
+	return err
+}
+
+// ValueAsBool converts an action value to a boolean.
+// This accepts "1", "true" and "on" as true, everything else is false.
+func ValueAsBool(value []byte) bool {
+	v := strings.ToLower(strings.Trim(string(value), "\" "))
+	return v == "1" || v == "true" || v == "on"
+}
+
+// boolValue returns the value of a boolean as it is published, "1" or "0"
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// HandleBindingAction handles actions of the binding Thing
+func (binding *OWServerBinding) HandleBindingAction(action *thing.ThingValue) {
+	var err error
+	switch action.ID {
+	case ActionCalibrate:
+		err = binding.HandleCalibrateAction(action.Data)
+	case ActionReplaceDevice:
+		err = binding.HandleReplaceDeviceAction(action.Data)
+	default:
+		err = fmt.Errorf("unknown binding action")
+	}
+	if err != nil {
+		logrus.Warningf("action '%s' failed: %s", action.ID, err)
+	}
+}
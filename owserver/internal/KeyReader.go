@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/hub/api/go/vocab"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// DeviceTypeKeyReader is the device type of the iButton key reader Thing
+const DeviceTypeKeyReader = "keyReader"
+
+// DefaultKeyReaderID is the default thing ID of the key reader
+const DefaultKeyReaderID = "keyReader"
+
+// Key reader event names
+const (
+	EventNameKeyPresented = "keyPresented"
+	EventNameKeyRemoved   = "keyRemoved"
+	EventNameUnknownKey   = "unknownKey"
+)
+
+// KeyEvent is the payload of the key reader events
+type KeyEvent struct {
+	ROMId string `json:"romId"`
+	Name  string `json:"name,omitempty"`
+}
+
+// getKeyReaderID returns the thing ID of the key reader
+func (binding *OWServerBinding) getKeyReaderID() string {
+	if binding.Config.KeyReader.ReaderID != "" {
+		return binding.Config.KeyReader.ReaderID
+	}
+	return DefaultKeyReaderID
+}
+
+// ApplyKeyReader removes the iButton key nodes from the list of nodes, records the
+// keys that are present and adds the reader node.
+// This returns the updated list of nodes.
+func (binding *OWServerBinding) ApplyKeyReader(nodes []*eds.OneWireNode) []*eds.OneWireNode {
+	cfg := binding.Config.KeyReader
+	keysPresent := make(map[string]bool)
+	names := make([]string, 0)
+	devices := make([]*eds.OneWireNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Family != eds.FamilyDS1990A {
+			devices = append(devices, node)
+			continue
+		}
+		keysPresent[node.NodeID] = true
+		if name, known := cfg.Keys[node.NodeID]; known {
+			names = append(names, name)
+		}
+	}
+	binding.keysPresent = keysPresent
+	sort.Strings(names)
+
+	title := cfg.Title
+	if title == "" {
+		title = "iButton key reader"
+	}
+	reader := &eds.OneWireNode{
+		NodeID:      binding.getKeyReaderID(),
+		Name:        title,
+		Description: "Presence of DS1990A iButton keys",
+		DeviceType:  DeviceTypeKeyReader,
+		Attr:        make(map[string]eds.OneWireAttr),
+		Alarms:      make(map[string]*eds.OneWireAlarm),
+	}
+	reader.Attr["presentKeys"] = eds.OneWireAttr{
+		ID:       "presentKeys",
+		Name:     "Keys present",
+		Value:    strings.Join(names, ","),
+		DataType: vocab.WoTDataTypeString,
+	}
+	devices = append(devices, reader)
+	return devices
+}
+
+// PublishKeyPresence publishes the key presented and removed events of keys that appeared
+// or disappeared since the last publication.
+func (binding *OWServerBinding) PublishKeyPresence(ctx context.Context) (err error) {
+	type keyEvent struct {
+		name string
+		ev   KeyEvent
+	}
+	events := make([]keyEvent, 0)
+	cfg := binding.Config.KeyReader
+
+	binding.mu.Lock()
+	for romID := range binding.keysPresent {
+		if binding.keysReported[romID] {
+			continue
+		}
+		if name, known := cfg.Keys[romID]; known {
+			events = append(events, keyEvent{EventNameKeyPresented, KeyEvent{ROMId: romID, Name: name}})
+		} else {
+			events = append(events, keyEvent{EventNameUnknownKey, KeyEvent{ROMId: romID}})
+		}
+	}
+	for romID := range binding.keysReported {
+		if binding.keysPresent[romID] {
+			continue
+		}
+		// unknown keys are reported without a name
+		events = append(events, keyEvent{EventNameKeyRemoved, KeyEvent{ROMId: romID, Name: cfg.Keys[romID]}})
+	}
+	binding.keysReported = binding.keysPresent
+	binding.mu.Unlock()
+
+	// the reader's thing ID follows the configured aliases
+	readerID := binding.ThingID(&eds.OneWireNode{NodeID: binding.getKeyReaderID()})
+	for _, keyEv := range events {
+		evJSON, _ := json.Marshal(keyEv.ev)
+		logrus.Infof("%s: key '%s' (%s)", keyEv.name, keyEv.ev.ROMId, keyEv.ev.Name)
+		err2 := binding.pubsub.PubEvent(ctx, readerID, keyEv.name, evJSON)
+		if err2 != nil {
+			err = err2
+		}
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// EventNameStatus is the event ID of device status changes
+const EventNameStatus = "status"
+
+// Device status values of the status event
+const (
+	StatusUnavailable = "unavailable"
+	StatusRecovered   = "recovered"
+	StatusRetired     = "retired"
+)
+
+// PresenceSaveInterval is the interval in which the time nodes were last seen is saved
+const PresenceSaveInterval = 10 * time.Minute
+
+// ITDRemover removes the TD of a Thing from the Hub directory
+type ITDRemover interface {
+	RemoveTD(ctx context.Context, publisherID, thingID string) error
+}
+
+// NodePresence tracks whether a node is still reported by the gateway.
+// This is persisted so devices that are missing at startup are reported, and a restart
+// doesn't reset the retirement clock.
+type NodePresence struct {
+	// LastSeen is the time the node was last reported
+	LastSeen time.Time `json:"lastSeen"`
+	// MissedPolls is the number of consecutive polls the node was missing
+	MissedPolls int `json:"missedPolls,omitempty"`
+	// Unavailable is set when the unavailable status was published
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// statusChange is a device status event that is waiting to be published
+type statusChange struct {
+	thingID string
+	status  string
+}
+
+// SetTDRemover sets the directory client that removes the TDs of retired and replaced
+// devices. The binding doesn't start without it.
+func (binding *OWServerBinding) SetTDRemover(remover ITDRemover) {
+	binding.tdRemover = remover
+}
+
+// presenceThingID returns the thing ID of a node for its status events.
+// This falls back to the thing ID of the last run for nodes that weren't polled since the
+// binding started, and to the node ID for nodes whose thing ID isn't determined yet.
+func (binding *OWServerBinding) presenceThingID(nodeID string) string {
+	if thingID, found := binding.thingIDs[nodeID]; found {
+		return thingID
+	} else if thingID, found = binding.state.ThingIDs[nodeID]; found {
+		return thingID
+	}
+	return nodeID
+}
+
+// TrackPresence updates the presence of the nodes after a successful heartbeat poll.
+// Nodes that are missing for UnavailablePolls polls become unavailable, and nodes that are
+// missing for RetireHours are retired and their state is cleared.
+// This must be called with the lock held, and returns true if the state must be saved.
+// The time a node was last seen is saved every PresenceSaveInterval, not on every poll, so
+// after an unclean shutdown a device isn't retired because of an outdated last seen time.
+func (binding *OWServerBinding) TrackPresence(polledNodes []*eds.OneWireNode, now time.Time) (stateChanged bool) {
+	seen := make(map[string]bool, len(polledNodes))
+	for _, node := range polledNodes {
+		seen[node.NodeID] = true
+		presence, found := binding.state.Presence[node.NodeID]
+		if !found {
+			presence = &NodePresence{}
+			binding.state.Presence[node.NodeID] = presence
+			stateChanged = true
+		}
+		if presence.Unavailable {
+			logrus.Infof("Node '%s' has recovered", node.NodeID)
+			binding.statusChanges = append(binding.statusChanges,
+				statusChange{thingID: binding.presenceThingID(node.NodeID), status: StatusRecovered})
+			stateChanged = true
+		}
+		presence.LastSeen = now
+		presence.MissedPolls = 0
+		presence.Unavailable = false
+	}
+	if now.Sub(binding.presenceSaved) >= PresenceSaveInterval {
+		binding.presenceSaved = now
+		stateChanged = true
+	}
+	retireAfter := time.Duration(binding.Config.RetireHours) * time.Hour
+	for nodeID, presence := range binding.state.Presence {
+		if seen[nodeID] {
+			continue
+		}
+		presence.MissedPolls++
+		thingID := binding.presenceThingID(nodeID)
+		if retireAfter > 0 && now.Sub(presence.LastSeen) >= retireAfter {
+			logrus.Infof("Node '%s' is retired after missing since %s", nodeID, presence.LastSeen.Format(time.RFC3339))
+			binding.statusChanges = append(binding.statusChanges,
+				statusChange{thingID: thingID, status: StatusRetired})
+			binding.forgetNode(nodeID)
+			stateChanged = true
+		} else if !presence.Unavailable && presence.MissedPolls >= binding.Config.UnavailablePolls {
+			logrus.Warningf("Node '%s' is unavailable after missing %d polls", nodeID, presence.MissedPolls)
+			presence.Unavailable = true
+			binding.statusChanges = append(binding.statusChanges,
+				statusChange{thingID: thingID, status: StatusUnavailable})
+			stateChanged = true
+		}
+	}
+	return stateChanged
+}
+
+// isUnavailable returns true if the node is reported as unavailable.
+// This must be called with the lock held.
+func (binding *OWServerBinding) isUnavailable(nodeID string) bool {
+	presence, found := binding.state.Presence[nodeID]
+	return found && presence.Unavailable
+}
+
+// forgetNode clears the in-memory state of a retired node.
+// Persisted state, such as calibration and device info, is kept in case the device returns.
+func (binding *OWServerBinding) forgetNode(nodeID string) {
+	delete(binding.nodes, nodeID)
+	delete(binding.values, nodeID)
+	delete(binding.alarmStates, nodeID)
+	delete(binding.sensors, nodeID)
+	delete(binding.switchActivity, nodeID)
+	delete(binding.outputLatches, nodeID)
+	delete(binding.health, nodeID)
+	delete(binding.tdFingerprints, nodeID)
+	delete(binding.state.Presence, nodeID)
+	if thingID, found := binding.thingIDs[nodeID]; found {
+		delete(binding.thingNodes, thingID)
+		delete(binding.thingIDs, nodeID)
+	}
+}
+
+// PublishStatusChanges publishes the pending device status events and removes the TDs of
+// retired devices from the directory.
+func (binding *OWServerBinding) PublishStatusChanges(ctx context.Context) (err error) {
+	binding.mu.Lock()
+	changes := binding.statusChanges
+	binding.statusChanges = nil
+	binding.mu.Unlock()
+
+	for _, change := range changes {
+		statusJSON, _ := json.Marshal(change.status)
+		err2 := binding.pubsub.PubEvent(ctx, change.thingID, EventNameStatus, statusJSON)
+		if err2 == nil && change.status == StatusRetired {
+			err2 = binding.tdRemover.RemoveTD(ctx, binding.Config.BindingID, change.thingID)
+		}
+		if err2 != nil {
+			err = err2
+		}
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"github.com/hiveot/hub/lib/thing"
+)
+
+// localize returns the text in the configured language and its translations by language.
+// Texts without translation are returned as-is with a nil map.
+func (binding *OWServerBinding) localize(text string) (string, map[string]string) {
+	if text == "" {
+		return text, nil
+	}
+	translations := binding.catalog.Translations(text)
+	if translation, found := translations[binding.Config.Language]; found {
+		text = translation
+	}
+	return text, translations
+}
+
+// localizeTD sets the titles and descriptions of the TD and its affordances in the
+// configured language, and adds their translations.
+func (binding *OWServerBinding) localizeTD(td *thing.TD) {
+	td.Title, td.Titles = binding.localize(td.Title)
+	td.Description, td.Descriptions = binding.localize(td.Description)
+	for _, prop := range td.Properties {
+		prop.Title, prop.Titles = binding.localize(prop.Title)
+		prop.Description, prop.Descriptions = binding.localize(prop.Description)
+		for i := range prop.OneOf {
+			prop.OneOf[i].Title, prop.OneOf[i].Titles = binding.localize(prop.OneOf[i].Title)
+		}
+	}
+	for _, ev := range td.Events {
+		ev.Title, ev.Titles = binding.localize(ev.Title)
+		ev.Description, ev.Descriptions = binding.localize(ev.Description)
+	}
+	for _, action := range td.Actions {
+		action.Title, action.Titles = binding.localize(action.Title)
+		action.Description, action.Descriptions = binding.localize(action.Description)
+	}
+}
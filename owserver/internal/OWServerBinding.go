@@ -9,6 +9,7 @@ import (
 	"github.com/hiveot/hub/api/go/hubapi"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/hiveot/hub/api/go/vocab"
 
 	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/bindings/owserver/internal/i18n"
 )
 
 // OWServerBinding is the hub protocol binding plugin for capturing 1-wire OWServer V2 Data
@@ -44,52 +46,147 @@ type OWServerBinding struct {
 	// nodes by deviceID/thingID
 	nodes map[string]*eds.OneWireNode
 
+	// last known hardware alarm states for detecting transitions
+	// map of [node/device ID] [alarm ID] active
+	alarmStates map[string]map[string]bool
+
+	// sensor states for the plausibility checks and the rejected readings
+	// map of [node/device ID] [attribute ID] state
+	sensors map[string]map[string]*SensorState
+	health  map[string]*NodeHealth
+
+	// DS2408 input activity to report, and the output latches with a lock to serialize writes
+	switchActivity map[string][]int
+	outputLatches  map[string]*outputLatch
+	outputMu       sync.Mutex
+
+	// fingerprint of the last published TD of each node, for detecting changes
+	tdFingerprints map[string]string
+
+	// thing IDs by node ID, node IDs by thing ID, and the gateway MAC for the thing ID template
+	thingIDs   map[string]string
+	thingNodes map[string]string
+	gatewayMAC string
+
+	// ROMId of replaced devices by the ROMId of their replacement
+	replacedIDs map[string]string
+
+	// status events to publish and the directory to remove retired TDs
+	statusChanges []statusChange
+	tdRemover     ITDRemover
+	// time the presence was last marked for saving
+	presenceSaved time.Time
+
+	// channel of each device and topology events to publish
+	deviceChannels map[string]int
+	topologyEvents []topologyEvent
+
+	// optional WoT HTTP server
+	httpServer *HTTPServer
+
+	// translations of TD titles and descriptions
+	catalog *i18n.Catalog
+
+	// binding state that is persisted
+	state *BindingState
+
+	// iButton keys that are present on the bus and keys whose presence is reported
+	keysPresent  map[string]bool
+	keysReported map[string]bool
+
 	// Map of previous node values [nodeID][attrName]value
 	// nodeValues map[string]map[string]string
 
 	// flag, this service is up and isRunning
 	isRunning atomic.Bool
 	mu        sync.Mutex
+	// saveMu serializes writing the state file, as polling and actions save concurrently
+	saveMu sync.Mutex
 }
 
 // CreateBindingTD generates a TD document for this binding
 func (binding *OWServerBinding) CreateBindingTD() *thing.TD {
 	thingID := binding.Config.BindingID
 	td := thing.NewTD(thingID, "OWServer binding", vocab.DeviceTypeBinding)
+	td.AtContext = []string{TDContext}
 	// these are configured through the configuration file.
 	prop := td.AddProperty(vocab.VocabPollInterval, vocab.VocabPollInterval, "Poll Interval", vocab.WoTDataTypeInteger, "")
 	prop.Unit = vocab.UnitNameSecond
-	prop.InitialValue = fmt.Sprintf("%d %s", binding.Config.PollInterval, vocab.UnitNameSecond)
+	prop.InitialValue = fmt.Sprintf("%d", binding.Config.PollInterval)
 
 	prop = td.AddProperty("tdInterval", vocab.VocabPollInterval, "TD Publication Interval", vocab.WoTDataTypeInteger, "")
 	prop.Unit = vocab.UnitNameSecond
-	prop.InitialValue = fmt.Sprintf("%d %s", binding.Config.TDInterval, vocab.UnitNameSecond)
+	prop.InitialValue = fmt.Sprintf("%d", binding.Config.TDInterval)
 
 	prop = td.AddProperty("valueInterval", vocab.VocabPollInterval, "Value Republication Interval", vocab.WoTDataTypeInteger, "")
 	prop.Unit = vocab.UnitNameSecond
-	prop.InitialValue = fmt.Sprintf("%d %s", binding.Config.RepublishInterval, vocab.UnitNameSecond)
+	prop.InitialValue = fmt.Sprintf("%d", binding.Config.RepublishInterval)
 
 	prop = td.AddProperty("owServerAddress", vocab.VocabGatewayAddress, "OWServer gateway IP address", vocab.WoTDataTypeString, "")
-	prop.InitialValue = fmt.Sprintf("%s", binding.Config.OWServerAddress)
+	prop.InitialValue = binding.Config.OWServerAddress
+
+	calibrateSchema := &thing.DataSchema{
+		Type: vocab.WoTDataTypeObject,
+		Properties: map[string]thing.DataSchema{
+			"thingID":   {Title: "Thing ID of the device", Type: vocab.WoTDataTypeString},
+			"attr":      {Title: "Attribute to calibrate, eg Temperature", Type: vocab.WoTDataTypeString},
+			"reference": {Title: "Reference value", Type: vocab.WoTDataTypeNumber},
+		},
+	}
+	td.AddAction(ActionCalibrate, ActionCalibrate, "Calibrate sensor",
+		"Record a reference value to compute the calibration offset of a sensor", calibrateSchema)
+
+	replaceSchema := &thing.DataSchema{
+		Type: vocab.WoTDataTypeObject,
+		Properties: map[string]thing.DataSchema{
+			"thingID": {Title: "Thing ID of the replaced device", Type: vocab.WoTDataTypeString},
+			"romId":   {Title: "ROMId of the new device", Type: vocab.WoTDataTypeString},
+		},
+	}
+	td.AddAction(ActionReplaceDevice, ActionReplaceDevice, "Replace device",
+		"Let a new device take over the Thing, settings and calibration of a failed device", replaceSchema)
+	binding.localizeTD(td)
 	return td
 }
 
 // Start the OWServer protocol binding
 // This connects to the hub pubsub, publishes a TD for this binding, starts a background heartbeat,
 // and waits for the context to complete and end the connection.
+// This fails if no TD remover is set.
 //
 //	ctx context to wait on.
 func (binding *OWServerBinding) Start(ctx context.Context) error {
+	// retired and replaced devices must be removed from the directory
+	if binding.tdRemover == nil {
+		return fmt.Errorf("no directory client to remove the TDs of retired devices")
+	}
 
 	// Create the adapter for the OWServer 1-wire gateway
 	binding.edsAPI = eds.NewEdsAPI(
 		binding.Config.OWServerAddress, binding.Config.LoginName, binding.Config.Password)
 
-	// TODO: restore binding configuration
+	// restore the binding state
+	err := binding.LoadState()
+	if err != nil {
+		logrus.Warningf("unable to load binding state: %s", err)
+	}
+
+	// the HTTP server receives the published events
+	if binding.Config.HTTPAddress != "" {
+		binding.httpServer = NewHTTPServer(binding, binding.Config.HTTPAddress)
+		err = binding.httpServer.Start()
+		if err != nil {
+			binding.pubsub.Release()
+			return err
+		}
+	}
 
 	td := binding.CreateBindingTD()
 	tdDoc, _ := json.Marshal(td)
-	err := binding.pubsub.PubEvent(ctx, td.ID, hubapi.EventNameTD, tdDoc)
+	err = binding.validateTD(td.ID, tdDoc)
+	if err == nil {
+		err = binding.pubsub.PubEvent(ctx, td.ID, hubapi.EventNameTD, tdDoc)
+	}
 	if err != nil {
 		return err
 	}
@@ -106,6 +203,11 @@ func (binding *OWServerBinding) Start(ctx context.Context) error {
 
 	<-ctx.Done()
 	binding.isRunning.Store(false)
+	if binding.httpServer != nil {
+		binding.httpServer.Stop()
+	}
+	// counters and presence are saved when their state changes, not on every poll
+	_ = binding.SaveState()
 	binding.pubsub.Release()
 	return nil
 }
@@ -124,12 +226,27 @@ func NewOWServerBinding(config OWServerBindingConfig, devicePubSub pubsub.IDevic
 
 	// these are from hub configuration
 	pb := &OWServerBinding{
-		pubsub:    devicePubSub,
-		values:    make(map[string]map[string]NodeValueStamp),
-		nodes:     make(map[string]*eds.OneWireNode),
-		isRunning: atomic.Bool{},
+		pubsub:         devicePubSub,
+		values:         make(map[string]map[string]NodeValueStamp),
+		nodes:          make(map[string]*eds.OneWireNode),
+		alarmStates:    make(map[string]map[string]bool),
+		sensors:        make(map[string]map[string]*SensorState),
+		health:         make(map[string]*NodeHealth),
+		state:          NewBindingState(),
+		switchActivity: make(map[string][]int),
+		outputLatches:  make(map[string]*outputLatch),
+		tdFingerprints: make(map[string]string),
+		thingIDs:       make(map[string]string),
+		thingNodes:     make(map[string]string),
+		replacedIDs:    make(map[string]string),
+		keysPresent:    make(map[string]bool),
+		keysReported:   make(map[string]bool),
+		isRunning:      atomic.Bool{},
 	}
 	pb.Config = config
+	pb.Config.VirtualThings = validVirtualThings(config.VirtualThings)
+	pb.catalog = i18n.NewCatalog()
+	pb.catalog.AddTranslations(config.Translations)
 
 	return pb
 }
@@ -3,8 +3,13 @@ package internal_test
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -19,6 +24,8 @@ import (
 	"github.com/hiveot/hub/pkg/pubsub/service"
 
 	"github.com/hiveot/bindings/owserver/internal"
+	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/bindings/owserver/internal/tdvalidate"
 	"github.com/hiveot/hub/api/go/vocab"
 )
 
@@ -48,6 +55,7 @@ func TestMain(m *testing.M) {
 	owsConfig = internal.NewBindingConfig()
 	owsConfig.BindingID = testBindingID
 	owsConfig.OWServerAddress = owsSimulationFile
+	owsConfig.StrictTDValidation = true
 
 	result := m.Run()
 	time.Sleep(time.Second)
@@ -59,6 +67,25 @@ func TestMain(m *testing.M) {
 	os.Exit(result)
 }
 
+// testRemover records the thing IDs whose TD the binding removes from the directory
+type testRemover struct {
+	mu      sync.Mutex
+	removed []string
+}
+
+func (r *testRemover) RemoveTD(_ context.Context, _, thingID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removed = append(r.removed, thingID)
+	return nil
+}
+
+func (r *testRemover) Removed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.removed...)
+}
+
 func TestStartStop(t *testing.T) {
 	logrus.Infof("--- TestStartStop ---")
 	ctx, ctxCancelFn := context.WithCancel(context.Background())
@@ -67,6 +94,11 @@ func TestStartStop(t *testing.T) {
 	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
 	require.NoError(t, err)
 	svc := internal.NewOWServerBinding(owsConfig, ps)
+	// the binding doesn't start without a directory client to remove TDs
+	err = svc.Start(ctx)
+	assert.Error(t, err)
+
+	svc.SetTDRemover(&testRemover{})
 	go func() {
 		err := svc.Start(ctx)
 		assert.NoError(t, err)
@@ -83,6 +115,7 @@ func TestPoll(t *testing.T) {
 	devicePubSub, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
 	require.NoError(t, err)
 	svc := internal.NewOWServerBinding(owsConfig, devicePubSub)
+	svc.SetTDRemover(&testRemover{})
 
 	// Count the number of received TD events
 	servicePubSub, err := pubSubClient.CapServicePubSub(ctx, "testclient")
@@ -153,6 +186,7 @@ func TestPollInvalidEDSAddress(t *testing.T) {
 	devicePubSub, err := pubSubClient.CapDevicePubSub(nil, owsConfig.BindingID)
 	require.NoError(t, err)
 	svc := internal.NewOWServerBinding(owsConfig, devicePubSub)
+	svc.SetTDRemover(&testRemover{})
 	svc.Config.OWServerAddress = "http://invalidAddress/"
 
 	go func() {
@@ -181,6 +215,7 @@ func TestAction(t *testing.T) {
 	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
 	require.NoError(t, err)
 	svc := internal.NewOWServerBinding(owsConfig, ps)
+	svc.SetTDRemover(&testRemover{})
 	go func() {
 		err := svc.Start(ctx)
 		assert.NoError(t, err)
@@ -197,3 +232,902 @@ func TestAction(t *testing.T) {
 	time.Sleep(time.Second * 1)
 	svc.Stop()
 }
+
+func TestPulseCounters(t *testing.T) {
+	logrus.Infof("--- TestPulseCounters ---")
+	const nodeID = "C100100000267C7E"
+
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.Counters = map[string]map[string]internal.CounterConfig{
+		nodeID: {"Counter1": {PulsesPerUnit: 1000, Unit: "m3", Offset: 10, Decimals: 3}},
+	}
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(&testRemover{})
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.NodeID == nodeID {
+			// the simulation has 8214566 pulses on counter 1
+			assert.Equal(t, "8224.566", node.Attr["Counter1"].Value)
+			assert.Equal(t, "m3", node.Attr["Counter1"].Unit)
+			assert.Equal(t, "8317049", node.Attr["Counter2"].Value)
+			// first poll has no rate
+			assert.Equal(t, "0.000", node.Attr["Counter1Rate"].Value)
+		}
+	}
+	svc.Stop()
+}
+
+func TestAnalogScaling(t *testing.T) {
+	// 4-20mA over 250 Ohm for 0-10 bar
+	cfg := internal.AnalogConfig{RawLow: 1, RawHigh: 5, Low: 0, High: 10}
+	assert.Equal(t, float64(5), cfg.Scale(3))
+	assert.Equal(t, float64(0), cfg.Scale(1))
+	// no scaling when not configured
+	assert.Equal(t, 3.3, internal.AnalogConfig{}.Scale(3.3))
+}
+
+func TestVirtualThings(t *testing.T) {
+	logrus.Infof("--- TestVirtualThings ---")
+	const supplyID = "AC000004A1B2C328"
+	const returnID = "29000004A1B2C428"
+	cfg := owsConfig
+	cfg.VirtualThings = []internal.VirtualThingConfig{{
+		ThingID: "heating",
+		Title:   "Heating",
+		Sensors: []internal.VirtualSensorConfig{{
+			ID:         "deltaT",
+			Decimals:   1,
+			Expression: supplyID + ".Temperature - " + returnID + ".Temperature",
+		}, {
+			ID:         "missing",
+			Expression: "28FFFFFFFF000000.Temperature * 2",
+		}},
+	}, {
+		// virtual Things without a thing ID are ignored
+		Title: "No thing ID",
+	}}
+	svc := internal.NewOWServerBinding(cfg, nil)
+
+	supply := &eds.OneWireNode{NodeID: supplyID, Attr: map[string]eds.OneWireAttr{
+		"Temperature": {ID: "Temperature", Value: "45.25"}}}
+	ret := &eds.OneWireNode{NodeID: returnID, Attr: map[string]eds.OneWireAttr{
+		"Temperature": {ID: "Temperature", Value: "38.0"}}}
+	vNodes := svc.CreateVirtualNodes([]*eds.OneWireNode{supply, ret})
+	require.Len(t, vNodes, 1)
+	assert.Equal(t, "heating", vNodes[0].NodeID)
+	assert.Equal(t, "7.3", vNodes[0].Attr["deltaT"].Value)
+	assert.True(t, vNodes[0].Attr["deltaT"].IsSensor)
+	// sensors with missing inputs have no value
+	missing, found := vNodes[0].Attr["missing"]
+	assert.True(t, found)
+	assert.Empty(t, missing.Value)
+}
+
+func TestGroupThings(t *testing.T) {
+	logrus.Infof("--- TestGroupThings ---")
+	cfg := owsConfig
+	cfg.Groups = []internal.GroupConfig{{
+		ThingID: "coldroom2",
+		Title:   "Cold room 2",
+		Members: []string{"2A000003BB170B28", "49000001BCEAD428"},
+		Aggregates: map[string][]string{
+			"Temperature": {internal.AggregateAvg, internal.AggregateMin, internal.AggregateMax},
+		},
+		Limits: map[string]internal.RangeConfig{"Temperature": {Min: -30, Max: 20.35}},
+	}, {
+		ThingID:    "coldroom3",
+		Title:      "Cold room 3",
+		Members:    []string{"2A000003BB170B28", "AC000004A1B2C328"},
+		Aggregates: map[string][]string{"Temperature": {internal.AggregateMax}},
+	}, {
+		ThingID:    "coldroom4",
+		Title:      "Cold room 4",
+		Members:    []string{"AC000004A1B2C328"},
+		Aggregates: map[string][]string{"Temperature": {internal.AggregateAvg}},
+	}}
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(&testRemover{})
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	defer svc.Stop()
+
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+	groups := make(map[string]*eds.OneWireNode)
+	for _, node := range nodes {
+		groups[node.NodeID] = node
+	}
+	// the simulation temperatures are 20.375 and 20.25
+	room2 := groups["coldroom2"]
+	require.NotNil(t, room2)
+	assert.Equal(t, "20.3", room2.Attr["TemperatureMin"].Value)
+	assert.Equal(t, "20.4", room2.Attr["TemperatureMax"].Value)
+	assert.Contains(t, room2.Attr, "TemperatureAvg")
+	assert.Equal(t, "1", room2.Attr[internal.EventNameGroupAlarm].Value)
+	assert.Equal(t, "0", room2.Attr[internal.PropNameDegraded].Value)
+	assert.Equal(t, "coldroom2", svc.ThingID(room2))
+
+	// a member that was never seen degrades the group
+	room3 := groups["coldroom3"]
+	require.NotNil(t, room3)
+	assert.Equal(t, "20.4", room3.Attr["TemperatureMax"].Value)
+	// room 3 has no limits, so it isn't in alarm
+	assert.Equal(t, "0", room3.Attr[internal.EventNameGroupAlarm].Value)
+	assert.Equal(t, "1", room3.Attr[internal.PropNameDegraded].Value)
+	assert.Equal(t, "1", room3.Attr[internal.PropNameAvailableMembers].Value)
+
+	// the aggregate of a group without member readings is kept without a value
+	room4 := groups["coldroom4"]
+	require.NotNil(t, room4)
+	require.Contains(t, room4.Attr, "TemperatureAvg")
+	assert.Empty(t, room4.Attr["TemperatureAvg"].Value)
+
+	td := svc.CreateTDFromNode(room2)
+	tdDoc, _ := json.Marshal(td)
+	assert.Empty(t, tdvalidate.Validate(tdDoc))
+}
+
+func TestSplitThings(t *testing.T) {
+	logrus.Infof("--- TestSplitThings ---")
+	const romID = "8E0010000012347E"
+	cfg := owsConfig
+	cfg.SplitThings = map[string]internal.SplitConfig{
+		"EDS0068": {},
+		"EDS0065": {Children: map[string]internal.ChildThingConfig{
+			"Light": {Title: "Attic light", Location: "Attic"}}},
+	}
+	svc := internal.NewOWServerBinding(cfg, nil)
+	newNode := func(model string) *eds.OneWireNode {
+		return &eds.OneWireNode{NodeID: romID, Model: model, Name: "Multisensor",
+			Attr: map[string]eds.OneWireAttr{
+				"Temperature": {ID: "Temperature", Name: "Temperature", IsSensor: true,
+					DataType: vocab.WoTDataTypeNumber, Value: "21.5"},
+				"Light": {ID: "Light", Name: "Light", IsSensor: true,
+					DataType: vocab.WoTDataTypeNumber, Value: "120"},
+				"Health": {ID: "Health", Name: "Health", IsSensor: true,
+					DataType: vocab.WoTDataTypeNumber, Value: "7"},
+				"relay": {ID: "RelayState", Name: "Relay", IsSensor: true,
+					DataType: vocab.WoTDataTypeBool, Value: "0"},
+				"TemperatureHighAlarmValue": {ID: "TemperatureHighAlarmValue", Writable: true, Value: "30"},
+				"led":                       {ID: "LEDState", IsActuator: true, Writable: true},
+			},
+			Alarms: map[string]*eds.OneWireAlarm{
+				"TemperatureHigh": {ID: "TemperatureHigh", Quantity: "Temperature", Limit: eds.AlarmLimitHigh}},
+		}
+	}
+	// each measured quantity becomes a child
+	node := newNode("EDS0068")
+	children := svc.SplitNode(node)
+	require.Len(t, children, 2)
+	// the parent keeps the health, relay state and actuator
+	assert.Len(t, node.Attr, 3)
+	assert.Len(t, node.Alarms, 0)
+
+	for _, child := range children {
+		assert.Equal(t, romID, child.ParentID)
+		assert.Equal(t, romID, child.Attr[internal.PropNameParent].Value)
+		if child.NodeID == internal.ChildThingID(romID, "Light") {
+			assert.Equal(t, "Light", child.Name)
+		} else {
+			assert.Equal(t, internal.ChildThingID(romID, "Temperature"), child.NodeID)
+			assert.Contains(t, child.Attr, "TemperatureHighAlarmValue")
+			assert.Contains(t, child.Alarms, "TemperatureHigh")
+		}
+	}
+	// only the listed children are split
+	node = newNode("EDS0065")
+	children = svc.SplitNode(node)
+	require.Len(t, children, 1)
+	assert.Equal(t, "Attic light", children[0].Name)
+	assert.Equal(t, "Attic", children[0].Attr[internal.PropNameLocation].Value)
+	assert.Contains(t, node.Attr, "Temperature")
+
+	// the DS18B20 thresholds keep the ID of their user byte and move with the temperature
+	cfg.SplitThings = map[string]internal.SplitConfig{"DS18B20": {}}
+	svc = internal.NewOWServerBinding(cfg, nil)
+	node = &eds.OneWireNode{NodeID: "2A000003BB170B28", Model: "DS18B20", Name: "Thermometer",
+		Attr: map[string]eds.OneWireAttr{
+			"Temperature": {ID: "Temperature", Name: "Temperature", IsSensor: true,
+				DataType: vocab.WoTDataTypeNumber, Value: "20.375"},
+			"TemperatureHighAlarmValue": {ID: eds.DS18B20TH, Writable: true, Value: "30"},
+			"TemperatureLowAlarmValue":  {ID: eds.DS18B20TL, Writable: true, Value: "10"},
+		},
+		Alarms: map[string]*eds.OneWireAlarm{
+			"TemperatureHigh": {ID: "TemperatureHigh", Quantity: "Temperature", Limit: eds.AlarmLimitHigh},
+			"TemperatureLow":  {ID: "TemperatureLow", Quantity: "Temperature", Limit: eds.AlarmLimitLow}},
+	}
+	children = svc.SplitNode(node)
+	require.Len(t, children, 1)
+	assert.Contains(t, children[0].Attr, "TemperatureHighAlarmValue")
+	assert.Contains(t, children[0].Attr, "TemperatureLowAlarmValue")
+	assert.Len(t, children[0].Alarms, 2)
+	assert.Empty(t, node.Attr)
+
+	// nodes of other models are not split
+	assert.Nil(t, svc.SplitNode(&eds.OneWireNode{NodeID: "28000001", Model: "EDS0066"}))
+}
+
+func TestPlausibility(t *testing.T) {
+	logrus.Infof("--- TestPlausibility ---")
+	cfg := owsConfig
+	cfg.Plausibility.MaxChange = map[string]float64{"Temperature": 5}
+	svc := internal.NewOWServerBinding(cfg, nil)
+	poll := func(value string) bool {
+		node := &eds.OneWireNode{NodeID: "2A000003BB170B28", Family: eds.FamilyDS18B20,
+			Attr: map[string]eds.OneWireAttr{
+				"Temperature": {ID: "Temperature", IsSensor: true, Value: value, RawValue: value}}}
+		svc.ApplyPlausibility(node)
+		return node.Attr["Temperature"].Rejected
+	}
+	// power-on reset and out of range values are rejected
+	assert.True(t, poll("85.0"))
+	assert.True(t, poll("4095"))
+	assert.True(t, poll("130"))
+	assert.False(t, poll("21.5"))
+	// a step change is accepted when confirmed by the next poll
+	assert.True(t, poll("40.0"))
+	assert.False(t, poll("40.5"))
+	assert.False(t, poll("41.0"))
+
+	// the DS18B20 range does not apply to other families
+	node := &eds.OneWireNode{NodeID: "8E0010000012347E", Family: "7E",
+		Attr: map[string]eds.OneWireAttr{
+			"Temperature": {ID: "Temperature", IsSensor: true, Value: "130", RawValue: "130"}}}
+	svc.ApplyPlausibility(node)
+	assert.False(t, node.Attr["Temperature"].Rejected)
+}
+
+func TestTDSchema(t *testing.T) {
+	logrus.Infof("--- TestTDSchema ---")
+	svc := internal.NewOWServerBinding(owsConfig, nil)
+	node := &eds.OneWireNode{NodeID: "2A000003BB170B28", Family: eds.FamilyDS18B20,
+		Attr: map[string]eds.OneWireAttr{
+			"Temperature": {ID: "Temperature", IsSensor: true, VocabType: vocab.VocabTemperature,
+				DataType: vocab.WoTDataTypeNumber, Decimals: 1, Value: "21.5"},
+			"Resolution": {ID: "Resolution", VocabType: "resolution", Writable: true,
+				DataType: vocab.WoTDataTypeNumber, Decimals: -1, Min: 9, Max: 12,
+				Enum: []string{"9", "10", "11", "12"}, Value: "12"},
+		}}
+	td := svc.CreateTDFromNode(node)
+	prop := td.Properties["Resolution"]
+	require.NotNil(t, prop)
+	assert.Equal(t, "resolution", prop.AtType)
+	assert.False(t, prop.ReadOnly)
+	assert.Equal(t, float64(12), prop.Maximum)
+	assert.Equal(t, []interface{}{9.0, 10.0, 11.0, 12.0}, prop.Enum)
+	assert.Equal(t, float64(0), prop.MultipleOf)
+
+	ev := td.Events["Temperature"]
+	require.NotNil(t, ev)
+	require.NotNil(t, ev.Data)
+	assert.Equal(t, 0.1, ev.Data.MultipleOf)
+}
+
+func TestNodeFingerprint(t *testing.T) {
+	node := &eds.OneWireNode{NodeID: "2A000003BB170B28", Family: eds.FamilyDS18B20,
+		Attr: map[string]eds.OneWireAttr{
+			"Temperature": {ID: "Temperature", IsSensor: true, Value: "21.5"}}}
+	fp1 := internal.NodeFingerprint(node)
+	// value changes don't change the structure
+	node.Attr["Temperature"] = eds.OneWireAttr{ID: "Temperature", IsSensor: true, Value: "22.0"}
+	assert.Equal(t, fp1, internal.NodeFingerprint(node))
+	// new attributes do
+	node.Attr["Resolution"] = eds.OneWireAttr{ID: "Resolution", Value: "12"}
+	assert.NotEqual(t, fp1, internal.NodeFingerprint(node))
+}
+
+func TestValidateSimulationTDs(t *testing.T) {
+	logrus.Infof("--- TestValidateSimulationTDs ---")
+	violations, err := internal.ValidateSimulationTDs(owsSimulationFile)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestLocalizedTD(t *testing.T) {
+	logrus.Infof("--- TestLocalizedTD ---")
+	cfg := owsConfig
+	cfg.Language = "nl"
+	cfg.Translations = map[string]map[string]string{"fr": {"Temperature": "Température de l'eau"}}
+	svc := internal.NewOWServerBinding(cfg, nil)
+	node := &eds.OneWireNode{NodeID: "2A000003BB170B28", Family: eds.FamilyDS18B20,
+		Attr: map[string]eds.OneWireAttr{
+			"Temperature": {ID: "Temperature", Name: "Temperature", IsSensor: true,
+				VocabType: vocab.VocabTemperature, DataType: vocab.WoTDataTypeNumber, Value: "21.5"}}}
+	td := svc.CreateTDFromNode(node)
+	ev := td.Events["Temperature"]
+	require.NotNil(t, ev)
+	assert.Equal(t, "Temperatuur", ev.Title)
+	assert.Equal(t, "Temperature", ev.Titles["en"])
+	assert.Equal(t, "Température de l'eau", ev.Titles["fr"])
+
+	bindingTD := svc.CreateBindingTD()
+	assert.Equal(t, "OWServer koppeling", bindingTD.Title)
+}
+
+func TestThingIDs(t *testing.T) {
+	logrus.Infof("--- TestThingIDs ---")
+	const romID = "2A000003BB170B28"
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+
+	// the first run uses the ROMId as thing ID
+	cfg := owsConfig
+	cfg.StoreFolder = tempFolder
+	cfg.BindingID = "owserver-thingid"
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(&testRemover{})
+	go func() { _ = svc.Start(ctx) }()
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(t, romID, svc.NodeIDOf(romID))
+	svc.Stop()
+
+	// after changing the template and adding an alias the old IDs are still accepted
+	cfg.ThingIDTemplate = "{gatewayMAC}-{romId}"
+	cfg.Aliases = map[string]string{"49000001BCEAD428": "boiler"}
+	svc2 := internal.NewOWServerBinding(cfg, ps)
+	svc2.SetTDRemover(&testRemover{})
+	go func() { _ = svc2.Start(ctx) }()
+	time.Sleep(time.Millisecond * 500)
+	nodes, err := svc2.PollNodes()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.NodeID == romID {
+			thingID := svc2.ThingID(node)
+			assert.Equal(t, "0004A3B1F2F0-"+romID, thingID)
+			// the TD keeps the ROMId property
+			td := svc2.CreateTDFromNode(node)
+			assert.Equal(t, thingID, td.ID)
+			assert.NotNil(t, td.Properties["ROMId"])
+		} else if node.NodeID == "49000001BCEAD428" {
+			assert.Equal(t, "boiler", svc2.ThingID(node))
+		}
+	}
+	assert.Equal(t, romID, svc2.NodeIDOf("0004A3B1F2F0-"+romID))
+	assert.Equal(t, romID, svc2.NodeIDOf(romID))
+	assert.Equal(t, "49000001BCEAD428", svc2.NodeIDOf("boiler"))
+	svc2.Stop()
+
+	// a first run with a template records the ROMId as the previous thing ID
+	cfg.BindingID = "owserver-thingid-template"
+	svc3 := internal.NewOWServerBinding(cfg, ps)
+	svc3.SetTDRemover(&testRemover{})
+	go func() { _ = svc3.Start(ctx) }()
+	time.Sleep(time.Millisecond * 500)
+	svc3.Stop()
+	stateJSON, err := os.ReadFile(path.Join(tempFolder, cfg.BindingID+".json"))
+	require.NoError(t, err)
+	var state internal.BindingState
+	err = json.Unmarshal(stateJSON, &state)
+	require.NoError(t, err)
+	assert.Equal(t, romID, state.PreviousThingIDs[romID])
+	assert.Equal(t, "0004A3B1F2F0-"+romID, state.ThingIDs[romID])
+}
+
+func TestDeviceInfo(t *testing.T) {
+	logrus.Infof("--- TestDeviceInfo ---")
+	const romID = "2A000003BB170B28"
+	cfg := owsConfig
+	cfg.StoreFolder = tempFolder
+	cfg.BindingID = "owserver-deviceinfo"
+	svc := internal.NewOWServerBinding(cfg, nil)
+	err := svc.SetDeviceInfo(romID, internal.PropNameTitle, []byte(`"Freezer"`))
+	require.NoError(t, err)
+	err = svc.SetDeviceInfo(romID, internal.PropNameLocation, []byte("Garage"))
+	require.NoError(t, err)
+	// concurrent saves leave a valid state file
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, svc.SaveState())
+		}()
+	}
+	wg.Wait()
+
+	// the device info survives a restart
+	svc2 := internal.NewOWServerBinding(cfg, nil)
+	err = svc2.LoadState()
+	require.NoError(t, err)
+	node := &eds.OneWireNode{NodeID: romID, Name: "owd_DS18B20", Family: eds.FamilyDS18B20,
+		Attr: map[string]eds.OneWireAttr{}}
+	svc2.ApplyDeviceInfo(node)
+	assert.Equal(t, "Freezer", node.Name)
+	assert.Equal(t, "Garage", node.Attr[internal.PropNameLocation].Value)
+	assert.True(t, node.Attr[internal.PropNameTitle].Writable)
+	td := svc2.CreateTDFromNode(node)
+	assert.Equal(t, "Freezer", td.Title)
+	assert.False(t, td.Properties[internal.PropNameDescription].ReadOnly)
+
+	// an empty value restores the default
+	err = svc2.SetDeviceInfo(romID, internal.PropNameTitle, []byte(""))
+	require.NoError(t, err)
+	node.Name = "owd_DS18B20"
+	svc2.ApplyDeviceInfo(node)
+	assert.Equal(t, "owd_DS18B20", node.Name)
+}
+
+func TestReplaceDevice(t *testing.T) {
+	logrus.Infof("--- TestReplaceDevice ---")
+	const oldID = "2A000003BB170B28"
+	const newID = "49000001BCEAD428"
+
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	cfg := owsConfig
+	cfg.StoreFolder = tempFolder
+	cfg.BindingID = "owserver-replace"
+	// events of this binding must not reach the subscribers of other tests
+	ps, err := pubSubClient.CapDevicePubSub(ctx, cfg.BindingID)
+	require.NoError(t, err)
+	cfg.Calibration = map[string]map[string]internal.CalibrationConfig{
+		oldID: {"Temperature": {Offset: -0.5}},
+	}
+	_ = os.RemoveAll(tempFolder)
+	svc := internal.NewOWServerBinding(cfg, ps)
+	remover := &testRemover{}
+	svc.SetTDRemover(remover)
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	defer svc.Stop()
+
+	_, err = svc.PollNodes()
+	require.NoError(t, err)
+	err = svc.SetDeviceInfo(oldID, internal.PropNameTitle, []byte("Freezer"))
+	require.NoError(t, err)
+	// settings, such as the alarm thresholds, are kept in case the device is retired
+	readState := func() *internal.BindingState {
+		stateJSON, err2 := os.ReadFile(path.Join(tempFolder, cfg.BindingID+".json"))
+		require.NoError(t, err2)
+		state := internal.NewBindingState()
+		err2 = json.Unmarshal(stateJSON, state)
+		require.NoError(t, err2)
+		return state
+	}
+	assert.NotEmpty(t, readState().Settings[oldID])
+
+	// the new device must be on the bus
+	args, _ := json.Marshal(internal.ReplaceDeviceArgs{ThingID: oldID, ROMId: "0500000012345601"})
+	err = svc.HandleReplaceDeviceAction(args)
+	assert.Error(t, err)
+
+	// without a directory client the new device's own Thing can't be removed
+	args, _ = json.Marshal(internal.ReplaceDeviceArgs{ThingID: oldID, ROMId: newID})
+	noDirectory := internal.NewOWServerBinding(cfg, ps)
+	err = noDirectory.HandleReplaceDeviceAction(args)
+	assert.Error(t, err)
+
+	err = svc.HandleReplaceDeviceAction(args)
+	require.NoError(t, err)
+	// the Thing that the new device published under its ROMId is removed
+	assert.Equal(t, []string{newID}, remover.Removed())
+
+	// the new device takes over the thing ID, title and calibration, and the old device is ignored
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+	var newNode *eds.OneWireNode
+	for _, node := range nodes {
+		assert.NotEqual(t, oldID, node.NodeID)
+		if node.NodeID == newID {
+			newNode = node
+		}
+	}
+	require.NotNil(t, newNode)
+	assert.Equal(t, oldID, svc.ThingID(newNode))
+	assert.Equal(t, newID, svc.NodeIDOf(oldID))
+	assert.Equal(t, "Freezer", newNode.Name)
+	// the simulation temperature is 20.25
+	assert.Equal(t, "19.8", newNode.Attr["Temperature"].Value)
+	state := readState()
+	assert.Empty(t, state.Settings[oldID])
+	assert.NotEmpty(t, state.Settings[newID])
+}
+
+func TestTopology(t *testing.T) {
+	logrus.Infof("--- TestTopology ---")
+	const romID = "49000001BCEAD428"
+	var changes []internal.TopologyChange
+	var mu sync.Mutex
+
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	svc := internal.NewOWServerBinding(owsConfig, ps)
+	svc.SetTDRemover(&testRemover{})
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	defer svc.Stop()
+	servicePubSub, err := pubSubClient.CapServicePubSub(ctx, "testclient")
+	require.NoError(t, err)
+	err = servicePubSub.SubEvent(ctx, owsConfig.BindingID, "", internal.EventNameTopologyChanged,
+		func(ev *thing.ThingValue) {
+			mu.Lock()
+			err2 := json.Unmarshal(ev.Data, &changes)
+			mu.Unlock()
+			assert.NoError(t, err2)
+		})
+	require.NoError(t, err)
+
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+	var gateway, device *eds.OneWireNode
+	for _, node := range nodes {
+		if node.DeviceType == vocab.DeviceTypeGateway {
+			gateway = node
+		} else if node.NodeID == romID {
+			device = node
+		}
+	}
+	require.NotNil(t, gateway)
+	require.NotNil(t, device)
+	// the gateway has a writable title, location and description like the devices
+	assert.True(t, gateway.Attr[internal.PropNameLocation].Writable)
+	var topology []internal.TopologyChannel
+	err = json.Unmarshal([]byte(gateway.Attr[internal.PropNameTopology].Value), &topology)
+	require.NoError(t, err)
+	// the simulation has 2 devices on channel 2 and 1 on channel 3
+	require.Len(t, topology, 3)
+	assert.Equal(t, 11, topology[1].DataErrors)
+	assert.Len(t, topology[1].Devices, 2)
+	require.Len(t, topology[2].Devices, 1)
+	assert.Equal(t, romID, topology[2].Devices[0].ROMId)
+	assert.Equal(t, "DS18B20", topology[2].Devices[0].Model)
+	assert.Equal(t, 7, topology[2].Devices[0].Health)
+	td := svc.CreateTDFromNode(gateway)
+	assert.Contains(t, td.Events, internal.EventNameTopologyChanged)
+	assert.NotNil(t, td.Events[internal.EventNameTopologyChanged].Data.ArrayItems)
+	topologyProp := td.Properties[internal.PropNameTopology]
+	require.NotNil(t, topologyProp)
+	assert.Equal(t, vocab.WoTDataTypeArray, topologyProp.Type)
+	assert.NotNil(t, topologyProp.ArrayItems)
+
+	// moving a device to another channel is reported
+	attr := device.Attr["Channel"]
+	attr.Value = "1"
+	device.Attr["Channel"] = attr
+	svc.UpdateTopology(gateway)
+	err = svc.PublishTopologyChanges(ctx)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, changes, 1)
+	assert.Equal(t, romID, changes[0].ROMId)
+	assert.Equal(t, 3, changes[0].From)
+	assert.Equal(t, 1, changes[0].To)
+}
+
+func TestLifecycle(t *testing.T) {
+	logrus.Infof("--- TestLifecycle ---")
+	const romA = "2A000003BB170B28"
+	const romB = "49000001BCEAD428"
+	var statusEvents []string
+	var mu sync.Mutex
+
+	ctx := context.Background()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.UnavailablePolls = 2
+	cfg.RetireHours = 1
+	remover := &testRemover{}
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(remover)
+	servicePubSub, err := pubSubClient.CapServicePubSub(ctx, "testclient")
+	require.NoError(t, err)
+	err = servicePubSub.SubEvent(ctx, owsConfig.BindingID, romB, internal.EventNameStatus,
+		func(ev *thing.ThingValue) {
+			var status string
+			_ = json.Unmarshal(ev.Data, &status)
+			mu.Lock()
+			statusEvents = append(statusEvents, status)
+			mu.Unlock()
+		})
+	require.NoError(t, err)
+
+	nodeA := &eds.OneWireNode{NodeID: romA, Family: eds.FamilyDS18B20}
+	nodeB := &eds.OneWireNode{NodeID: romB, Family: eds.FamilyDS18B20}
+	now := time.Now()
+	poll := func(nodes ...*eds.OneWireNode) {
+		svc.TrackPresence(nodes, now)
+		err2 := svc.PublishStatusChanges(ctx)
+		assert.NoError(t, err2)
+		now = now.Add(time.Minute)
+	}
+	poll(nodeA, nodeB)
+	// B goes missing for 2 polls, then recovers
+	poll(nodeA)
+	poll(nodeA)
+	poll(nodeA)
+	poll(nodeA, nodeB)
+	// B is retired when missing for the retirement period
+	poll(nodeA)
+	now = now.Add(time.Hour)
+	poll(nodeA)
+	time.Sleep(time.Millisecond * 10)
+	mu.Lock()
+	assert.ElementsMatch(t, []string{internal.StatusUnavailable, internal.StatusRecovered, internal.StatusRetired}, statusEvents)
+	statusEvents = nil
+	mu.Unlock()
+	// the TD of the retired device is removed from the directory
+	assert.Equal(t, []string{romB}, remover.Removed())
+
+	// presence survives a restart, so a device that is missing at startup is reported
+	cfg.StoreFolder = tempFolder
+	cfg.BindingID = "owserver-lifecycle"
+	svc = internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(remover)
+	poll(nodeA, nodeB)
+	err = svc.SaveState()
+	require.NoError(t, err)
+	svc = internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(remover)
+	err = svc.LoadState()
+	require.NoError(t, err)
+	poll(nodeA)
+	poll(nodeA)
+	time.Sleep(time.Millisecond * 10)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{internal.StatusUnavailable}, statusEvents)
+
+	// the last seen time is saved periodically, so it is recent after an unclean shutdown
+	assert.False(t, svc.TrackPresence([]*eds.OneWireNode{nodeA}, now))
+	now = now.Add(internal.PresenceSaveInterval)
+	assert.True(t, svc.TrackPresence([]*eds.OneWireNode{nodeA}, now))
+}
+
+func TestKeyReader(t *testing.T) {
+	logrus.Infof("--- TestKeyReader ---")
+	const knownKey = "0500000012345601"
+	const unknownKey = "4200000012345602"
+	var keyEvents = make(map[string][]string)
+	var mu sync.Mutex
+
+	ctx := context.Background()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.KeyReader = &internal.KeyReaderConfig{
+		ReaderID: "door",
+		Keys:     map[string]string{knownKey: "Alice"},
+	}
+	// key events are published to the reader's alias
+	cfg.Aliases = map[string]string{"door": "frontdoor"}
+	svc := internal.NewOWServerBinding(cfg, ps)
+
+	servicePubSub, err := pubSubClient.CapServicePubSub(ctx, "testclient")
+	require.NoError(t, err)
+	err = servicePubSub.SubEvent(ctx, owsConfig.BindingID, "frontdoor", "",
+		func(ev *thing.ThingValue) {
+			var keyEvent internal.KeyEvent
+			err2 := json.Unmarshal(ev.Data, &keyEvent)
+			assert.NoError(t, err2)
+			mu.Lock()
+			keyEvents[ev.ID] = append(keyEvents[ev.ID], keyEvent.ROMId)
+			mu.Unlock()
+		})
+	require.NoError(t, err)
+
+	gateway := &eds.OneWireNode{NodeID: "gateway"}
+	key1 := &eds.OneWireNode{NodeID: knownKey, Family: eds.FamilyDS1990A}
+	key2 := &eds.OneWireNode{NodeID: unknownKey, Family: eds.FamilyDS1990A}
+
+	// keys are replaced by the reader
+	nodes := svc.ApplyKeyReader([]*eds.OneWireNode{gateway, key1, key2})
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "door", nodes[1].NodeID)
+	assert.Equal(t, "Alice", nodes[1].Attr["presentKeys"].Value)
+	err = svc.PublishKeyPresence(ctx)
+	assert.NoError(t, err)
+
+	// keys are removed
+	svc.ApplyKeyReader([]*eds.OneWireNode{gateway})
+	err = svc.PublishKeyPresence(ctx)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 100)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{knownKey}, keyEvents[internal.EventNameKeyPresented])
+	assert.Equal(t, []string{unknownKey}, keyEvents[internal.EventNameUnknownKey])
+	// removal of unknown keys is also reported
+	assert.ElementsMatch(t, []string{knownKey, unknownKey}, keyEvents[internal.EventNameKeyRemoved])
+}
+
+func TestCalibration(t *testing.T) {
+	logrus.Infof("--- TestCalibration ---")
+	const nodeID = "2A000003BB170B28"
+
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.StoreFolder = tempFolder
+	cfg.Calibration = map[string]map[string]internal.CalibrationConfig{
+		nodeID: {"Temperature": {Offset: -0.5}},
+	}
+	_ = os.RemoveAll(tempFolder)
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(&testRemover{})
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	// the simulation temperature is 20.375
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.NodeID == nodeID {
+			assert.Equal(t, "19.9", node.Attr["Temperature"].Value)
+			assert.NotEmpty(t, node.Attr["Temperature"].Description)
+		}
+	}
+
+	// record a reference value
+	args, _ := json.Marshal(internal.CalibrateArgs{ThingID: nodeID, Attr: "Temperature", Reference: 21})
+	err = svc.HandleCalibrateAction(args)
+	require.NoError(t, err)
+	nodes, err = svc.PollNodes()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.NodeID == nodeID {
+			assert.Equal(t, "21.0", node.Attr["Temperature"].Value)
+		}
+	}
+	svc.Stop()
+
+	// the recorded calibration is restored on startup
+	svc2 := internal.NewOWServerBinding(cfg, ps)
+	svc2.SetTDRemover(&testRemover{})
+	go func() {
+		err := svc2.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	nodes, err = svc2.PollNodes()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.NodeID == nodeID {
+			assert.Equal(t, "21.0", node.Attr["Temperature"].Value)
+		}
+	}
+	svc2.Stop()
+}
+
+func TestHTTPServer(t *testing.T) {
+	logrus.Infof("--- TestHTTPServer ---")
+	const romID = "2A000003BB170B28"
+
+	ctx, ctxCancelFn := context.WithCancel(context.Background())
+	defer ctxCancelFn()
+	ps, err := pubSubClient.CapDevicePubSub(ctx, owsConfig.BindingID)
+	require.NoError(t, err)
+	cfg := owsConfig
+	// republish unchanged values so the event isn't missed when the heartbeat published it
+	cfg.RepublishInterval = 0
+	svc := internal.NewOWServerBinding(cfg, ps)
+	svc.SetTDRemover(&testRemover{})
+	svr := internal.NewHTTPServer(svc, "")
+	ts := httptest.NewServer(svr)
+	defer ts.Close()
+	go func() {
+		err := svc.Start(ctx)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	defer svc.Stop()
+	nodes, err := svc.PollNodes()
+	require.NoError(t, err)
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+	// the TD has forms for each operation
+	status, body := get("/things/" + romID)
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, tdvalidate.Validate(body))
+	var td map[string]interface{}
+	err = json.Unmarshal(body, &td)
+	require.NoError(t, err)
+	assert.NotEmpty(t, td["forms"])
+	props := td["properties"].(map[string]interface{})
+	assert.NotEmpty(t, props["Resolution"].(map[string]interface{})["forms"])
+	var tdList []interface{}
+	status, body = get("/things")
+	require.Equal(t, http.StatusOK, status)
+	err = json.Unmarshal(body, &tdList)
+	require.NoError(t, err)
+	assert.Greater(t, len(tdList), 3)
+	// only paths below the things path are served
+	status, _ = get("/things" + romID)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// properties are read from the last polled values
+	var values map[string]interface{}
+	status, body = get("/things/" + romID + "/properties")
+	require.Equal(t, http.StatusOK, status)
+	err = json.Unmarshal(body, &values)
+	require.NoError(t, err)
+	status, body = get("/things/" + romID + "/properties/Resolution")
+	require.Equal(t, http.StatusOK, status)
+	var resolution interface{}
+	err = json.Unmarshal(body, &resolution)
+	require.NoError(t, err)
+	assert.Equal(t, values["Resolution"], resolution)
+	status, _ = get("/things/" + romID + "/properties/unknown")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/things/unknown")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// a long-poll request returns the next event
+	eventCh := make(chan []byte, 1)
+	go func() {
+		_, body := get("/things/" + romID + "/events/Temperature")
+		eventCh <- body
+	}()
+	time.Sleep(time.Millisecond * 10)
+	err = svc.PublishNodeValues(nodes)
+	require.NoError(t, err)
+	select {
+	case body = <-eventCh:
+		assert.Equal(t, "20.4", string(body))
+	case <-time.After(time.Second):
+		t.Error("no event received")
+	}
+
+	// unknown actions are refused
+	resp, err := http.Post(ts.URL+"/things/"+romID+"/actions/unknown", "application/json", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHTTPServerNoHub(t *testing.T) {
+	logrus.Infof("--- TestHTTPServerNoHub ---")
+	// the address is taken, so the binding fails to start and releases the connection
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	cfg := owsConfig
+	cfg.HTTPAddress = listener.Addr().String()
+	svc := internal.NewOWServerBinding(cfg, nil)
+	svc.SetTDRemover(&testRemover{})
+	err = svc.Start(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// EventNameHealth is the event ID of the health event with rejected readings.
+// This differs from the 'Health' sensor that some EDS devices report.
+const EventNameHealth = "readingHealth"
+
+// Reasons for rejecting a reading
+const (
+	RejectReasonRange    = "outOfRange"
+	RejectReasonSentinel = "sentinel"
+	RejectReasonChange   = "maxChange"
+	RejectReasonStuck    = "stuck"
+)
+
+// ds18b20PowerOnValue is the temperature a DS18B20 reports after a power-on reset
+const ds18b20PowerOnValue = 85.0
+
+// DefaultValidRanges are the valid ranges of sensor readings by attribute ID
+var DefaultValidRanges = map[string]RangeConfig{
+	"BarometricPressureMb": {Min: 300, Max: 1100},
+	"DewPoint":             {Min: -55, Max: 125},
+	"HeatIndex":            {Min: -55, Max: 125},
+	"Humidex":              {Min: -55, Max: 125},
+	"Humidity":             {Min: 0, Max: 100},
+	"Light":                {Min: 0, Max: 200000},
+}
+
+// ds18b20ValidRange is the valid temperature range of the DS18B20
+var ds18b20ValidRange = RangeConfig{Min: -55, Max: 125}
+
+// SensorSentinels are values that sensors report on a read failure, by attribute ID
+var SensorSentinels = map[string][]float64{
+	"Temperature": {-127, 4095},
+}
+
+// RejectedReading describes a sensor reading that failed the plausibility check
+type RejectedReading struct {
+	Attr   string `json:"attr"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// HealthEvent is the payload of the health event, published when readings are rejected
+type HealthEvent struct {
+	// Rejected is the total number of rejected readings of the node since the binding started
+	Rejected int `json:"rejected"`
+	// Readings that were rejected in the last poll
+	Readings []RejectedReading `json:"readings"`
+}
+
+// SensorState tracks the readings of a sensor across polls for the plausibility checks
+type SensorState struct {
+	// last accepted value
+	lastValue float64
+	// a reading that exceeded the maximum change, accepted when confirmed by the next poll
+	pendingValue *float64
+	// last value and the time it last changed
+	rawValue   string
+	rawChanged time.Time
+}
+
+// NodeHealth holds the rejected readings of a node
+type NodeHealth struct {
+	rejected int
+	readings []RejectedReading
+}
+
+// checkReading returns the reason a reading is rejected, or "" if it is plausible.
+//
+//	value is the reading after calibration
+//	raw is the reading as reported, used for sentinel and stuck detection
+//	sentinels and valid range of the quantity
+//	maxChange is the maximum change since the last accepted value, 0 to ignore
+//	stuckDuration is the time the reading can stay identical, 0 to ignore
+func (ss *SensorState) checkReading(value float64, raw string, sentinels []float64,
+	valid RangeConfig, maxChange float64, stuckDuration time.Duration, now time.Time) string {
+
+	if ss.rawChanged.IsZero() || raw != ss.rawValue {
+		ss.rawValue = raw
+		ss.rawChanged = now
+	}
+	rawValue, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		rawValue = value
+	}
+	for _, sentinel := range sentinels {
+		if rawValue == sentinel {
+			return RejectReasonSentinel
+		}
+	}
+	if valid.Min < valid.Max && (value < valid.Min || value > valid.Max) {
+		return RejectReasonRange
+	}
+	if stuckDuration > 0 && now.Sub(ss.rawChanged) >= stuckDuration {
+		return RejectReasonStuck
+	}
+	if maxChange > 0 && !math.IsNaN(ss.lastValue) && math.Abs(value-ss.lastValue) > maxChange {
+		// a step change is accepted when the next reading confirms it
+		confirmed := ss.pendingValue != nil && math.Abs(value-*ss.pendingValue) <= maxChange
+		if !confirmed {
+			ss.pendingValue = &value
+			return RejectReasonChange
+		}
+	}
+	ss.pendingValue = nil
+	ss.lastValue = value
+	return ""
+}
+
+// ApplyPlausibility checks the sensor readings of the node and marks implausible readings
+// as rejected. Rejected readings are not published and are reported in the health event.
+func (binding *OWServerBinding) ApplyPlausibility(node *eds.OneWireNode) {
+	cfg := binding.Config.Plausibility
+	if cfg.Disabled {
+		return
+	}
+	now := time.Now()
+	stuckDuration := time.Duration(cfg.StuckHours * float64(time.Hour))
+	for attrID, attr := range node.Attr {
+		if !attr.IsSensor || attr.IsCounter {
+			continue
+		}
+		value, err := strconv.ParseFloat(attr.Value, 64)
+		if err != nil {
+			continue
+		}
+		nodeSensors, found := binding.sensors[node.NodeID]
+		if !found {
+			nodeSensors = make(map[string]*SensorState)
+			binding.sensors[node.NodeID] = nodeSensors
+		}
+		ss, found := nodeSensors[attrID]
+		if !found {
+			ss = &SensorState{lastValue: math.NaN()}
+			nodeSensors[attrID] = ss
+		}
+		valid, found := cfg.Ranges[attrID]
+		if !found {
+			valid = DefaultValidRanges[attrID]
+			if node.Family == eds.FamilyDS18B20 && attrID == "Temperature" {
+				valid = ds18b20ValidRange
+			}
+		}
+		sentinels := SensorSentinels[attrID]
+		if node.Family == eds.FamilyDS18B20 && attrID == "Temperature" {
+			sentinels = append([]float64{ds18b20PowerOnValue}, sentinels...)
+		}
+		// sentinel and stuck detection use the reading as reported by the gateway, if available
+		raw := attr.RawValue
+		if raw == "" {
+			raw = attr.Value
+		}
+		reason := ss.checkReading(value, raw, sentinels, valid, cfg.MaxChange[attrID], stuckDuration, now)
+		if reason == "" {
+			continue
+		}
+		logrus.Warningf("rejected reading '%s' of node '%s': %s (%s)", attrID, node.NodeID, attr.Value, reason)
+		attr.Rejected = true
+		node.Attr[attrID] = attr
+		health, found := binding.health[node.NodeID]
+		if !found {
+			health = &NodeHealth{}
+			binding.health[node.NodeID] = health
+		}
+		health.rejected++
+		health.readings = append(health.readings, RejectedReading{Attr: attrID, Value: attr.Value, Reason: reason})
+	}
+}
+
+// PublishHealth publishes the health event of a node with the readings that were rejected
+// since the last publication.
+func (binding *OWServerBinding) PublishHealth(ctx context.Context, thingID string, node *eds.OneWireNode) error {
+	binding.mu.Lock()
+	health, found := binding.health[node.NodeID]
+	if !found || len(health.readings) == 0 {
+		binding.mu.Unlock()
+		return nil
+	}
+	ev := HealthEvent{Rejected: health.rejected, Readings: health.readings}
+	health.readings = nil
+	binding.mu.Unlock()
+
+	evJSON, _ := json.Marshal(ev)
+	return binding.pubsub.PubEvent(ctx, thingID, EventNameHealth, evJSON)
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// PublishAlarms publishes an alarm event for each hardware alarm of the node that changed state.
+// On the first poll only active alarms are published. Alarms of rejected readings keep their
+// previous state until the reading is plausible again.
+func (binding *OWServerBinding) PublishAlarms(ctx context.Context, thingID string, node *eds.OneWireNode) (err error) {
+	changed := make([]eds.AlarmEvent, 0)
+	binding.mu.Lock()
+	nodeAlarms, found := binding.alarmStates[node.NodeID]
+	if !found {
+		nodeAlarms = make(map[string]bool)
+		binding.alarmStates[node.NodeID] = nodeAlarms
+	}
+	for alarmID, alarm := range node.Alarms {
+		if node.Attr[alarm.Quantity].Rejected {
+			continue
+		}
+		wasActive, known := nodeAlarms[alarmID]
+		nodeAlarms[alarmID] = alarm.Active
+		if wasActive == alarm.Active && (known || !alarm.Active) {
+			continue
+		}
+		ev := eds.AlarmEvent{
+			Quantity: alarm.Quantity,
+			Limit:    alarm.Limit,
+			Active:   alarm.Active,
+			Unit:     alarm.Unit,
+		}
+		ev.Threshold, _ = strconv.ParseFloat(alarm.Threshold, 64)
+		ev.Value, _ = strconv.ParseFloat(node.Attr[alarm.Quantity].Value, 64)
+		logrus.Infof("Alarm '%s' of node '%s' active=%v", alarmID, node.NodeID, alarm.Active)
+		changed = append(changed, ev)
+	}
+	binding.mu.Unlock()
+
+	for _, ev := range changed {
+		evJSON, _ := json.Marshal(ev)
+		err2 := binding.pubsub.PubEvent(ctx, thingID, eds.EventNameAlarm, evJSON)
+		if err2 != nil {
+			err = err2
+		}
+	}
+	return err
+}
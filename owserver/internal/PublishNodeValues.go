@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/hub/api/go/vocab"
 )
 
 type NodeValueStamp struct {
@@ -44,10 +45,21 @@ func (binding *OWServerBinding) PublishNodeValues(nodes []*eds.OneWireNode) (err
 	for _, node := range nodes {
 		// send all changed property attributes in a single properties event
 		attrMap := make(map[string][]byte)
-		//thingID := thing.CreateThingID(binding.Config.BindingID, node.NodeID, node.DeviceType)
-		thingID := node.NodeID
+		thingID := binding.ThingID(node)
 
 		for attrName, attr := range node.Attr {
+			// attributes without value, eg commands, are not published
+			if attr.DataType == vocab.WoTDataTypeNone {
+				continue
+			}
+			// implausible readings are reported in the health event instead
+			if attr.Rejected {
+				continue
+			}
+			// sensors without a reading, eg a virtual sensor whose input is missing
+			if attr.IsSensor && attr.Value == "" {
+				continue
+			}
 			// only send the changed values
 			prevValue, found := binding.getPrevValue(node.NodeID, attrName)
 			age := time.Now().Sub(prevValue.timestamp)
@@ -71,13 +83,41 @@ func (binding *OWServerBinding) PublishNodeValues(nodes []*eds.OneWireNode) (err
 			attrMapJSON, _ := json.Marshal(attrMap)
 			err = binding.pubsub.PubEvent(ctx, thingID, hubapi.EventNameProperties, attrMapJSON)
 		}
+		if len(node.Alarms) > 0 {
+			err2 := binding.PublishAlarms(ctx, thingID, node)
+			if err2 != nil {
+				err = err2
+			}
+		}
+		if err2 := binding.PublishHealth(ctx, thingID, node); err2 != nil {
+			err = err2
+		}
+		if node.Family == eds.FamilyDS2408 {
+			err2 := binding.PublishSwitchActivity(ctx, thingID, node)
+			if err2 != nil {
+				err = err2
+			}
+		}
+	}
+	if err2 := binding.PublishStatusChanges(ctx); err2 != nil {
+		err = err2
+	}
+	if err2 := binding.PublishTopologyChanges(ctx); err2 != nil {
+		err = err2
+	}
+	if binding.Config.KeyReader != nil {
+		err2 := binding.PublishKeyPresence(ctx)
+		if err2 != nil {
+			err = err2
+		}
 	}
 	return err
 }
 
-// RefreshPropertyValues polls the OWServer hub for changed Thing values
+// RefreshPropertyValues polls the OWServer hub for changed Thing values.
+// This isn't a heartbeat poll and doesn't count towards the unavailable limit of devices.
 func (binding *OWServerBinding) RefreshPropertyValues() error {
-	nodes, err := binding.edsAPI.PollNodes()
+	nodes, err := binding.pollNodes(false)
 	//nodeValueMap, err := binding.PollNodeValues()
 	if err == nil {
 		err = binding.PublishNodeValues(nodes)
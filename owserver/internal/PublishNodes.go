@@ -2,8 +2,15 @@ package internal
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/hiveot/hub/api/go/hubapi"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
 	"github.com/hiveot/bindings/owserver/internal/eds"
 	"github.com/hiveot/hub/api/go/vocab"
@@ -17,11 +24,11 @@ import (
 // - Writable sensors are also added as actions.
 func (binding *OWServerBinding) CreateTDFromNode(node *eds.OneWireNode) (tdoc *thing.TD) {
 
-	// Should we bother with the URI? In HiveOT things have pubsub addresses that include the ID. The ID is not the address.
-	//thingID := thing.CreateThingID(binding.Config.BindingID, node.NodeID, node.DeviceType)
-	thingID := node.NodeID
+	// The thing ID is configurable. The ROMId property identifies the physical device.
+	thingID := binding.ThingID(node)
 
 	tdoc = thing.NewTD(thingID, node.Name, node.DeviceType)
+	tdoc.AtContext = []string{TDContext}
 	tdoc.UpdateTitleDescription(node.Name, node.Description)
 
 	// Map node attribute to Thing properties
@@ -35,39 +42,37 @@ func (binding *OWServerBinding) CreateTDFromNode(node *eds.OneWireNode) (tdoc *t
 			title := attr.Name
 			// only add data schema if the event carries a value
 			if attr.DataType != vocab.WoTDataTypeNone {
-				evSchema = &thing.DataSchema{
-					Type:         attr.DataType,
-					Unit:         attr.Unit,
-					InitialValue: attr.Value,
-				}
-				if attr.Unit != "" {
-					evSchema.InitialValue += " " + attr.Unit
-				}
+				schema := AttrDataSchema(attr)
+				evSchema = &schema
+				evSchema.InitialValue = attr.Value
 			}
-			tdoc.AddEvent(eventID, evType, title, "", evSchema)
+			tdoc.AddEvent(eventID, evType, title, attr.Description, evSchema)
 
 		} else if attr.IsActuator {
-			// TODO: determine action @type
 			var inputSchema *thing.DataSchema
 			actionID := attrName
 			actionType := attr.VocabType
 			// only add data schema if the action accepts parameters
 			if attr.DataType != vocab.WoTDataTypeNone {
-				inputSchema = &thing.DataSchema{
-					Type: attr.DataType,
-					Unit: attr.Unit,
-				}
+				schema := AttrDataSchema(attr)
+				schema.Title = attr.Name
+				inputSchema = &schema
 			}
-			tdoc.AddAction(actionID, actionType, attr.Name, "", inputSchema)
+			tdoc.AddAction(actionID, actionType, attr.Name, attr.Description, inputSchema)
 		} else {
-			// TODO: determine property @type
-			propType := ""
-			initialValue := attr.Value
-			if attr.Unit != "" {
-				initialValue += " " + attr.Unit
+			propType := attr.VocabType
+			prop := tdoc.AddProperty(attrName, propType, attr.Name, attr.DataType, attr.Value)
+			schema := AttrDataSchema(attr)
+			prop.Unit = schema.Unit
+			prop.Minimum = schema.Minimum
+			prop.Maximum = schema.Maximum
+			prop.MultipleOf = schema.MultipleOf
+			prop.Enum = schema.Enum
+			prop.OneOf = schema.OneOf
+			prop.Description = attr.Description
+			if attrName == PropNameTopology {
+				prop.ArrayItems = topologyChannelSchema
 			}
-			prop := tdoc.AddProperty(attrName, propType, attr.Name, attr.DataType, initialValue)
-			prop.Unit = attr.Unit
 			// non-sensors are attributes. Writable attributes are configuration.
 			if attr.Writable {
 				prop.ReadOnly = false
@@ -76,29 +81,246 @@ func (binding *OWServerBinding) CreateTDFromNode(node *eds.OneWireNode) (tdoc *t
 			}
 		}
 	}
+	// hardware alarms emit a single alarm event that describes the alarm
+	if len(node.Alarms) > 0 {
+		alarmSchema := &thing.DataSchema{
+			Type: vocab.WoTDataTypeObject,
+			Properties: map[string]thing.DataSchema{
+				"quantity":  {Title: "Measured quantity", Type: vocab.WoTDataTypeString},
+				"limit":     {Title: "Alarm limit, high or low", Type: vocab.WoTDataTypeString},
+				"active":    {Title: "Alarm is active", Type: vocab.WoTDataTypeBool},
+				"threshold": {Title: "Alarm threshold", Type: vocab.WoTDataTypeNumber},
+				"value":     {Title: "Measured value", Type: vocab.WoTDataTypeNumber},
+				"unit":      {Title: "Unit of threshold and value", Type: vocab.WoTDataTypeString},
+			},
+		}
+		tdoc.AddEvent(eds.EventNameAlarm, vocab.VocabAlarmState, "Alarm", "", alarmSchema)
+	}
+	// the key reader reports keys that are presented and removed
+	if node.DeviceType == DeviceTypeKeyReader {
+		keySchema := &thing.DataSchema{
+			Type: vocab.WoTDataTypeObject,
+			Properties: map[string]thing.DataSchema{
+				"romId": {Title: "ROM ID of the key", Type: vocab.WoTDataTypeString},
+				"name":  {Title: "Name of the key holder, if known", Type: vocab.WoTDataTypeString},
+			},
+		}
+		tdoc.AddEvent(EventNameKeyPresented, EventNameKeyPresented, "Key presented", "", keySchema)
+		tdoc.AddEvent(EventNameKeyRemoved, EventNameKeyRemoved, "Key removed", "", keySchema)
+		tdoc.AddEvent(EventNameUnknownKey, EventNameUnknownKey, "Unknown key presented", "", keySchema)
+	}
+	// rejected sensor readings are reported in the health event
+	if node.Family != "" {
+		healthSchema := &thing.DataSchema{
+			Type: vocab.WoTDataTypeObject,
+			Properties: map[string]thing.DataSchema{
+				"rejected": {Title: "Total number of rejected readings", Type: vocab.WoTDataTypeInteger},
+				"readings": {Title: "Rejected readings with attr, value and reason", Type: vocab.WoTDataTypeArray,
+					ArrayItems: thing.DataSchema{
+						Type: vocab.WoTDataTypeObject,
+						Properties: map[string]thing.DataSchema{
+							"attr":   {Title: "Attribute", Type: vocab.WoTDataTypeString},
+							"value":  {Title: "Value", Type: vocab.WoTDataTypeString},
+							"reason": {Title: "Reason", Type: vocab.WoTDataTypeString},
+						},
+					}},
+			},
+		}
+		tdoc.AddEvent(EventNameHealth, EventNameHealth, "Sensor health", "", healthSchema)
+	}
+	// devices report when they become unavailable, recover or are retired
+	if node.Family != "" || node.ParentID != "" {
+		statusSchema := &thing.DataSchema{
+			Type: vocab.WoTDataTypeString,
+			Enum: []interface{}{StatusUnavailable, StatusRecovered, StatusRetired},
+		}
+		tdoc.AddEvent(EventNameStatus, EventNameStatus, "Device status", "", statusSchema)
+	}
+	// the gateway reports devices that are added, removed or moved to another channel
+	if _, hasTopology := node.Attr[PropNameTopology]; hasTopology {
+		changeSchema := &thing.DataSchema{
+			Title:      "Devices with thingID, romId, and channel from and to",
+			Type:       vocab.WoTDataTypeArray,
+			ArrayItems: topologyChangeSchema,
+		}
+		tdoc.AddEvent(EventNameTopologyChanged, EventNameTopologyChanged, "Topology changed", "", changeSchema)
+	}
+	// switch inputs report activity between polls
+	if node.Family == eds.FamilyDS2408 {
+		activitySchema := &thing.DataSchema{Title: "Channel", Type: vocab.WoTDataTypeInteger}
+		tdoc.AddEvent(eds.EventNameActivity, eds.VocabSwitch, "Input activity", "", activitySchema)
+	}
+	binding.localizeTD(tdoc)
 	return
 }
 
-// PollNodes polls the OWServer gateway for nodes and property values
+// AttrDataSchema returns the data schema of an attribute value, including the allowed range,
+// the resolution of rounded numbers and the allowed values.
+func AttrDataSchema(attr eds.OneWireAttr) thing.DataSchema {
+	schema := thing.DataSchema{
+		Type: attr.DataType,
+		Unit: attr.Unit,
+	}
+	isNumber := attr.DataType == vocab.WoTDataTypeNumber || attr.DataType == vocab.WoTDataTypeInteger
+	if attr.Min < attr.Max {
+		schema.Minimum = attr.Min
+		schema.Maximum = attr.Max
+	}
+	if isNumber && attr.Decimals >= 0 {
+		schema.MultipleOf = math.Pow(10, -float64(attr.Decimals))
+	}
+	for i, enumValue := range attr.Enum {
+		// enums of numbers are numbers
+		var value interface{} = enumValue
+		if number, err := strconv.ParseFloat(enumValue, 64); err == nil && isNumber {
+			value = number
+		}
+		schema.Enum = append(schema.Enum, value)
+		// named values are described using oneOf
+		if i < len(attr.EnumTitles) {
+			schema.OneOf = append(schema.OneOf, thing.DataSchema{
+				Const: value,
+				Title: attr.EnumTitles[i],
+			})
+		}
+	}
+	return schema
+}
+
+// PollNodes polls the OWServer gateway for nodes and property values.
+// This is the heartbeat poll that also tracks the presence of the nodes.
 func (binding *OWServerBinding) PollNodes() ([]*eds.OneWireNode, error) {
+	return binding.pollNodes(true)
+}
+
+// pollNodes polls the OWServer gateway for nodes and property values.
+// The presence of nodes is only tracked on heartbeat polls so the unavailable limit is a
+// number of poll intervals. Polls that refresh the values after an action don't count.
+func (binding *OWServerBinding) pollNodes(trackPresence bool) ([]*eds.OneWireNode, error) {
 	nodes, err := binding.edsAPI.PollNodes()
+	binding.mu.Lock()
+	stateChanged := false
+	nodes = binding.removeReplaced(nodes)
+	if binding.Config.KeyReader != nil {
+		nodes = binding.ApplyKeyReader(nodes)
+	}
 	for _, node := range nodes {
+		binding.ApplyCalibration(node)
+		stateChanged = binding.ApplyCounters(node) || stateChanged
+		if node.Family == eds.FamilyDS2408 {
+			binding.ApplySwitchRegisters(node)
+		} else if node.Family == eds.FamilyDS2450 {
+			binding.ApplyAnalogScaling(node)
+		} else if node.Family == eds.FamilyDS2438 {
+			configID := binding.configID(node.NodeID)
+			eds.DS2438AddCurrent(node, binding.Config.DS2438SenseResistors[configID])
+			if binding.Config.DS2438Profiles[configID] == eds.DS2438ProfileHIH {
+				eds.DS2438AddHumidity(node)
+			}
+		}
+		binding.ApplyPlausibility(node)
+	}
+	// virtual Things are computed from the polled values and published like other nodes
+	virtualNodes := binding.CreateVirtualNodes(nodes)
+	// group Things aggregate the values of their members
+	virtualNodes = append(virtualNodes, binding.CreateGroupNodes(nodes)...)
+	// multisensors can be split into child Things
+	polledNodes := make([]*eds.OneWireNode, 0, len(nodes)+len(virtualNodes))
+	for _, node := range nodes {
+		polledNodes = append(polledNodes, node)
+		polledNodes = append(polledNodes, binding.SplitNode(node)...)
+	}
+	polledNodes = append(polledNodes, virtualNodes...)
+	for _, node := range polledNodes {
+		// the gateway, devices and their child Things have a user assigned title, location
+		// and description
+		if node.Family != "" || node.ParentID != "" || node.DeviceType == vocab.DeviceTypeGateway {
+			binding.ApplyDeviceInfo(node)
+		}
+		// settings are kept for a replacement of the device
+		if node.Family != "" || node.ParentID != "" {
+			stateChanged = binding.recordSettings(node) || stateChanged
+		}
 		binding.nodes[node.NodeID] = node
 	}
-	return nodes, err
+	stateChanged = binding.updateThingIDs(polledNodes) || stateChanged
+	// a failed poll says nothing about the presence of devices
+	if err == nil && trackPresence {
+		stateChanged = binding.TrackPresence(polledNodes, time.Now()) || stateChanged
+		for _, node := range polledNodes {
+			if node.DeviceType == vocab.DeviceTypeGateway {
+				binding.UpdateTopology(node)
+			}
+		}
+	}
+	binding.mu.Unlock()
+	if stateChanged {
+		_ = binding.SaveState()
+	}
+	return polledNodes, err
+}
+
+// NodeFingerprint returns a hash of the structure of the node's TD.
+// Attribute values are excluded, so the fingerprint only changes when the node gains or loses
+// attributes or alarms, or when their description changes.
+func NodeFingerprint(node *eds.OneWireNode) string {
+	structure := *node
+	structure.Attr = make(map[string]eds.OneWireAttr, len(node.Attr))
+	for attrID, attr := range node.Attr {
+		attr.Value = ""
+		attr.RawValue = ""
+		attr.Rejected = false
+		structure.Attr[attrID] = attr
+	}
+	structure.Alarms = make(map[string]*eds.OneWireAlarm, len(node.Alarms))
+	for alarmID := range node.Alarms {
+		structure.Alarms[alarmID] = nil
+	}
+	structureJSON, _ := json.Marshal(structure)
+	hash := sha256.Sum256(structureJSON)
+	return hex.EncodeToString(hash[:])
 }
 
 // PublishThings converts the nodes to TD documents and publishes these on the Hub message bus
 // This returns an error if one or more publications fail
 func (binding *OWServerBinding) PublishThings(nodes []*eds.OneWireNode) (err error) {
+	return binding.publishTDs(nodes, false)
+}
+
+// PublishChangedThings publishes the TD documents of new nodes and of nodes whose
+// structure changed since their TD was last published.
+func (binding *OWServerBinding) PublishChangedThings(nodes []*eds.OneWireNode) (err error) {
+	return binding.publishTDs(nodes, true)
+}
+
+// publishTDs publishes the TD of the nodes and records their fingerprint.
+// If onlyChanged is set then nodes whose fingerprint didn't change are skipped.
+func (binding *OWServerBinding) publishTDs(nodes []*eds.OneWireNode, onlyChanged bool) (err error) {
 	ctx := context.Background()
 	for _, node := range nodes {
+		fingerprint := NodeFingerprint(node)
+		binding.mu.Lock()
+		prevFingerprint, found := binding.tdFingerprints[node.NodeID]
+		binding.mu.Unlock()
+		if onlyChanged && found && prevFingerprint == fingerprint {
+			continue
+		}
 		td := binding.CreateTDFromNode(node)
 		tdDoc, _ := json.Marshal(td)
-		err2 := binding.pubsub.PubEvent(ctx, td.ID, hubapi.EventNameTD, tdDoc)
+		err2 := binding.validateTD(td.ID, tdDoc)
+		if err2 == nil {
+			err2 = binding.pubsub.PubEvent(ctx, td.ID, hubapi.EventNameTD, tdDoc)
+		}
 		if err2 != nil {
 			err = err2
+			continue
+		}
+		if onlyChanged {
+			logrus.Infof("Published TD of '%s' as it is new or its structure changed", node.NodeID)
 		}
+		binding.mu.Lock()
+		binding.tdFingerprints[node.NodeID] = fingerprint
+		binding.mu.Unlock()
 	}
 	return err
 }
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hiveot/hub/api/go/vocab"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// counterWrap is the counter value at which 32 bit hardware counters wrap around
+const counterWrap = float64(1 << 32)
+
+// counterRateSuffix is appended to the counter ID for its rate event
+const counterRateSuffix = "Rate"
+
+// CounterState tracks a pulse counter across polls to handle wrap and reset.
+// The counted pulses are persisted so totals continue after a restart.
+type CounterState struct {
+	// LastRaw is the last raw counter value
+	LastRaw float64 `json:"lastRaw"`
+	// Base holds the pulses counted before the last wrap or reset
+	Base float64 `json:"base"`
+	// total and time at the start of the rate interval, and the last computed rate
+	rateTotal float64
+	rateTime  time.Time
+	rate      float64
+}
+
+// getCounterConfig returns the scaling configuration of a counter with defaults applied.
+// The offset carried over from a replaced device takes precedence over the configured offset.
+func (binding *OWServerBinding) getCounterConfig(nodeID, counterID string) CounterConfig {
+	cfg := binding.Config.Counters[binding.configID(nodeID)][counterID]
+	if offset, found := binding.state.CounterOffsets[nodeID][counterID]; found {
+		cfg.Offset = offset
+	}
+	if cfg.PulsesPerUnit <= 0 {
+		cfg.PulsesPerUnit = 1
+	}
+	if cfg.Unit == "" {
+		cfg.Unit = vocab.UnitNameCount
+	}
+	return cfg
+}
+
+// updateCounter returns the total number of pulses.
+// A counter that decreases has either wrapped around at 32 bits or was reset.
+// In both cases the total continues from where it was. This returns true if the base changed.
+func (cs *CounterState) updateCounter(raw float64) (total float64, baseChanged bool) {
+	if raw < cs.LastRaw {
+		if cs.LastRaw > counterWrap*0.9 && raw < counterWrap*0.1 {
+			// the counter wrapped around
+			cs.Base += counterWrap
+		} else {
+			// the counter was reset or the device was replaced
+			cs.Base += cs.LastRaw
+		}
+		baseChanged = true
+	}
+	cs.LastRaw = raw
+	return cs.Base + raw, baseChanged
+}
+
+// updateRate returns the pulses per hour over the interval since the last rate update.
+// Polls that follow within the minimum interval, such as the refresh after an action,
+// return the last rate as their short interval would give an inaccurate rate.
+func (cs *CounterState) updateRate(total float64, now time.Time, minInterval time.Duration) float64 {
+	if cs.rateTime.IsZero() {
+		cs.rateTotal = total
+		cs.rateTime = now
+		return 0
+	}
+	elapsed := now.Sub(cs.rateTime)
+	if elapsed <= 0 || elapsed < minInterval {
+		return cs.rate
+	}
+	cs.rate = (total - cs.rateTotal) / elapsed.Hours()
+	cs.rateTotal = total
+	cs.rateTime = now
+	return cs.rate
+}
+
+// ApplyCounters replaces raw pulse counter values of the node with the scaled cumulative total,
+// and adds a rate attribute with the units per hour over the last poll interval.
+// This returns true if the persisted counter state changed.
+func (binding *OWServerBinding) ApplyCounters(node *eds.OneWireNode) (stateChanged bool) {
+	now := time.Now()
+	minInterval := time.Duration(binding.Config.PollInterval) * time.Second
+	for attrID, attr := range node.Attr {
+		if !attr.IsCounter {
+			continue
+		}
+		raw, err := strconv.ParseFloat(attr.Value, 64)
+		if err != nil {
+			continue
+		}
+		nodeCounters, found := binding.state.Counters[node.NodeID]
+		if !found {
+			nodeCounters = make(map[string]*CounterState)
+			binding.state.Counters[node.NodeID] = nodeCounters
+		}
+		cs, found := nodeCounters[attrID]
+		if !found {
+			cs = &CounterState{}
+			nodeCounters[attrID] = cs
+			stateChanged = true
+		}
+		cfg := binding.getCounterConfig(node.NodeID, attrID)
+		totalPulses, baseChanged := cs.updateCounter(raw)
+		stateChanged = stateChanged || baseChanged
+
+		total := cfg.Offset + totalPulses/cfg.PulsesPerUnit
+		attr.Value = strconv.FormatFloat(total, 'f', cfg.Decimals, 64)
+		attr.Decimals = cfg.Decimals
+		attr.Unit = cfg.Unit
+		if cfg.Title != "" {
+			attr.Name = cfg.Title
+		}
+		node.Attr[attrID] = attr
+
+		rate := cs.updateRate(totalPulses, now, minInterval) / cfg.PulsesPerUnit
+		// round the rate to the configured decimals
+		ratio := math.Pow(10, float64(cfg.Decimals))
+		rate = math.Round(rate*ratio) / ratio
+		node.Attr[attrID+counterRateSuffix] = eds.OneWireAttr{
+			ID:        attr.ID,
+			Name:      attr.Name + " rate",
+			VocabType: eds.VocabCounterRate,
+			Unit:      cfg.Unit + "/h",
+			Value:     strconv.FormatFloat(rate, 'f', cfg.Decimals, 64),
+			Decimals:  cfg.Decimals,
+			IsSensor:  true,
+			DataType:  vocab.WoTDataTypeNumber,
+		}
+	}
+	return stateChanged
+}
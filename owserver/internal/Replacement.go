@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// ActionReplaceDevice is the binding action that maps a new device to the Thing of a replaced device
+const ActionReplaceDevice = "replaceDevice"
+
+// ReplaceDeviceArgs is the input of the replaceDevice action
+type ReplaceDeviceArgs struct {
+	// ThingID of the device that is replaced
+	ThingID string `json:"thingID"`
+	// ROMId of the new device
+	ROMId string `json:"romId"`
+}
+
+// configID returns the ROMId under which the configuration of a node is kept.
+// A device that replaced another device uses the configuration of the original device.
+// This must be called with the lock held.
+func (binding *OWServerBinding) configID(nodeID string) string {
+	// follow the chain of replacements back to the original device
+	for i := 0; i < len(binding.replacedIDs); i++ {
+		replacedID, found := binding.replacedIDs[nodeID]
+		if !found {
+			break
+		}
+		nodeID = replacedID
+	}
+	return nodeID
+}
+
+// indexReplacements rebuilds the map of replaced devices by the ROMId of their replacement.
+// This must be called with the lock held after the replacements in the state changed.
+func (binding *OWServerBinding) indexReplacements() {
+	binding.replacedIDs = make(map[string]string, len(binding.state.Replacements))
+	for oldID, newID := range binding.state.Replacements {
+		binding.replacedIDs[newID] = oldID
+	}
+}
+
+// removeReplaced removes devices that were replaced from the polled nodes.
+// A replaced device that returns to the bus would otherwise claim the Thing of its replacement.
+func (binding *OWServerBinding) removeReplaced(nodes []*eds.OneWireNode) []*eds.OneWireNode {
+	if len(binding.state.Replacements) == 0 {
+		return nodes
+	}
+	result := make([]*eds.OneWireNode, 0, len(nodes))
+	for _, node := range nodes {
+		if _, isReplaced := binding.state.Replacements[node.NodeID]; !isReplaced {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// carryOverCounters sets the counter offsets of the new device so its totals continue
+// from the last totals of the replaced device. The totals are computed from the persisted
+// counter state, so this also works after the replaced device is retired.
+// This must be called with the lock held, after the replacement is recorded.
+func (binding *OWServerBinding) carryOverCounters(oldID, newID string) {
+	offsets := make(map[string]float64)
+	for counterID, offset := range binding.state.CounterOffsets[oldID] {
+		offsets[counterID] = offset
+	}
+	for counterID, oldState := range binding.state.Counters[oldID] {
+		oldCfg := binding.getCounterConfig(oldID, counterID)
+		oldTotal := oldCfg.Offset + (oldState.Base+oldState.LastRaw)/oldCfg.PulsesPerUnit
+		// pulses the new device already counted are added to the offset
+		newPulses := 0.0
+		if cs, found := binding.state.Counters[newID][counterID]; found {
+			newPulses = cs.Base + cs.LastRaw
+		}
+		cfg := binding.getCounterConfig(newID, counterID)
+		offsets[counterID] = oldTotal - newPulses/cfg.PulsesPerUnit
+	}
+	if len(offsets) > 0 {
+		binding.state.CounterOffsets[newID] = offsets
+	}
+	delete(binding.state.CounterOffsets, oldID)
+	delete(binding.state.Counters, oldID)
+}
+
+// isSetting returns true if the attribute is a writable setting, such as an alarm threshold.
+// Actuators, commands and device info are not settings.
+func isSetting(attrID string, attr eds.OneWireAttr) bool {
+	return attr.Writable && !attr.IsActuator && attr.DataType != vocab.WoTDataTypeNone && !isDeviceInfo(attrID)
+}
+
+// recordSettings keeps the writable settings of a device in the binding state, so they can
+// be copied to its replacement after the device is retired.
+// This must be called with the lock held, and returns true if a setting changed.
+func (binding *OWServerBinding) recordSettings(node *eds.OneWireNode) (changed bool) {
+	settings := binding.state.Settings[node.NodeID]
+	for attrID, attr := range node.Attr {
+		if !isSetting(attrID, attr) {
+			continue
+		}
+		if value, found := settings[attrID]; found && value == attr.Value {
+			continue
+		}
+		if settings == nil {
+			settings = make(map[string]string)
+			binding.state.Settings[node.NodeID] = settings
+		}
+		settings[attrID] = attr.Value
+		changed = true
+	}
+	return changed
+}
+
+// replacedSetting is a setting of a replaced device that is copied to the new device
+type replacedSetting struct {
+	node   *eds.OneWireNode
+	attrID string
+	attr   eds.OneWireAttr
+	value  string
+}
+
+// writableSettings returns the recorded settings of the replaced device that the new device
+// supports and that differ from its own.
+func writableSettings(settings map[string]string, newNode *eds.OneWireNode) []replacedSetting {
+	result := make([]replacedSetting, 0)
+	for attrID, value := range settings {
+		newAttr, found := newNode.Attr[attrID]
+		if !found || !isSetting(attrID, newAttr) || newAttr.Value == value {
+			continue
+		}
+		result = append(result, replacedSetting{node: newNode, attrID: attrID, attr: newAttr, value: value})
+	}
+	return result
+}
+
+// HandleReplaceDeviceAction maps a new device to the Thing of the device it replaces.
+// The new device takes over the thing ID, configuration, calibration, device info and
+// counter totals of the replaced device. Writable settings of the replaced device, such as
+// alarm thresholds, are written to the new device if it supports them.
+// The replaced device is ignored if it returns to the bus, and the Thing that the new device
+// published under its own thing ID is removed from the directory.
+func (binding *OWServerBinding) HandleReplaceDeviceAction(data []byte) error {
+	var args ReplaceDeviceArgs
+	err := json.Unmarshal(data, &args)
+	if err != nil {
+		return fmt.Errorf("invalid replaceDevice arguments: %w", err)
+	} else if binding.tdRemover == nil {
+		return fmt.Errorf("no directory client to remove the TD of the new device")
+	}
+	newID := strings.ToUpper(args.ROMId)
+	if _, err = eds.ParseROMId(newID); err != nil {
+		return fmt.Errorf("invalid ROM ID '%s': %w", args.ROMId, err)
+	}
+	oldID := binding.NodeIDOf(args.ThingID)
+
+	binding.mu.Lock()
+	newNode, found := binding.nodes[newID]
+	oldNode, oldFound := binding.nodes[oldID]
+	_, oldKnown := binding.state.ThingIDs[oldID]
+	// the family of a retired device follows from its ROM ID
+	oldFamily, _ := eds.ParseROMId(oldID)
+	if oldFound {
+		oldFamily = oldNode.Family
+	}
+	if !found || newNode.ParentID != "" {
+		err = fmt.Errorf("device '%s' is not on the bus", newID)
+	} else if oldID == newID {
+		err = fmt.Errorf("device '%s' can't replace itself", newID)
+	} else if !oldFound && !oldKnown {
+		err = fmt.Errorf("unknown thing '%s'", args.ThingID)
+	} else if _, isReplaced := binding.state.Replacements[newID]; isReplaced {
+		err = fmt.Errorf("device '%s' was replaced itself", newID)
+	} else if oldFamily != "" && oldFamily != newNode.Family {
+		err = fmt.Errorf("device '%s' of family %s can't replace a device of family %s",
+			newID, newNode.Family, oldFamily)
+	}
+	if err != nil {
+		binding.mu.Unlock()
+		return err
+	}
+	// the thing ID under which the new device was published so far
+	newThingID := binding.thingIDs[newID]
+
+	binding.state.Replacements[oldID] = newID
+	binding.indexReplacements()
+	if cal, found := binding.state.Calibration[oldID]; found {
+		binding.state.Calibration[newID] = cal
+		delete(binding.state.Calibration, oldID)
+	}
+	// device info of the child Things moves along with the device
+	for nodeID, info := range binding.state.DeviceInfo {
+		if nodeID == oldID {
+			binding.state.DeviceInfo[newID] = info
+			delete(binding.state.DeviceInfo, nodeID)
+		} else if strings.HasPrefix(nodeID, oldID+"-") {
+			quantity := strings.TrimPrefix(nodeID, oldID+"-")
+			binding.state.DeviceInfo[ChildThingID(newID, quantity)] = info
+			delete(binding.state.DeviceInfo, nodeID)
+		}
+	}
+	binding.carryOverCounters(oldID, newID)
+	// settings of split devices are kept in their child Things
+	settings := writableSettings(binding.state.Settings[oldID], newNode)
+	delete(binding.state.Settings, oldID)
+	for nodeID, childSettings := range binding.state.Settings {
+		if !strings.HasPrefix(nodeID, oldID+"-") {
+			continue
+		}
+		quantity := strings.TrimPrefix(nodeID, oldID+"-")
+		if newChild, found := binding.nodes[ChildThingID(newID, quantity)]; found {
+			settings = append(settings, writableSettings(childSettings, newChild)...)
+		}
+		delete(binding.state.Settings, nodeID)
+	}
+	for nodeID, child := range binding.nodes {
+		if child.ParentID == oldID {
+			binding.forgetNode(nodeID)
+		}
+	}
+	// the new device takes over the thing ID of the replaced device
+	thingID := binding.formatThingID(newNode)
+	binding.forgetNode(oldID)
+	delete(binding.state.ThingIDs, oldID)
+	delete(binding.thingNodes, newThingID)
+	binding.thingIDs[newID] = thingID
+	binding.thingNodes[thingID] = newID
+	binding.state.ThingIDs[newID] = thingID
+	// publish the TD and values of the new device under its new thing ID
+	delete(binding.tdFingerprints, newID)
+	delete(binding.values, newID)
+	binding.mu.Unlock()
+
+	logrus.Infof("Device '%s' replaces '%s' as thing '%s'", newID, oldID, thingID)
+	err = binding.SaveState()
+	if err == nil && newThingID != "" && newThingID != thingID {
+		err = binding.tdRemover.RemoveTD(context.Background(), binding.Config.BindingID, newThingID)
+	}
+	for _, setting := range settings {
+		err2 := binding.writeAttr(setting.node, setting.attrID, setting.attr, []byte(setting.value))
+		if err2 != nil {
+			logrus.Warningf("unable to copy '%s' to device '%s': %s", setting.attr.ID, newID, err2)
+		}
+	}
+	return err
+}
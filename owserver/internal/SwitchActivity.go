@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// outputLatchSettleTime is the time after writing an output latch during which polls don't
+// update the binding's copy of the latch, as the EDS can report the old value until the write
+// has completed.
+const outputLatchSettleTime = 10 * time.Second
+
+// outputLatch is the binding's copy of a DS2408 output latch register
+type outputLatch struct {
+	value   int
+	written time.Time
+}
+
+// ApplySwitchRegisters records the input activity and output latch of a DS2408 node and
+// replaces its raw registers with a sensor for each channel and an actuator for each output.
+// This must be called with the lock held.
+func (binding *OWServerBinding) ApplySwitchRegisters(node *eds.OneWireNode) {
+	if channels := eds.DS2408ActiveChannels(node); len(channels) > 0 {
+		binding.switchActivity[node.NodeID] = channels
+	}
+	if value, found := eds.DS2408OutputLatch(node); found {
+		latch, found := binding.outputLatches[node.NodeID]
+		if !found || time.Since(latch.written) > outputLatchSettleTime {
+			binding.outputLatches[node.NodeID] = &outputLatch{value: value}
+		}
+	}
+	eds.DS2408AddChannels(node, binding.Config.SwitchOutputs[binding.configID(node.NodeID)])
+}
+
+// writeOutput switches an output channel of a DS2408 device.
+// Writes are serialized and start from the binding's copy of the output latch, so switching
+// outputs in quick succession doesn't undo a previous write that the EDS hasn't reported yet.
+//
+//	actionID is the output action ID, eg output1
+func (binding *OWServerBinding) writeOutput(deviceID string, actionID string, on bool) error {
+	binding.outputMu.Lock()
+	defer binding.outputMu.Unlock()
+
+	binding.mu.Lock()
+	latch, found := binding.outputLatches[deviceID]
+	binding.mu.Unlock()
+	if !found {
+		return fmt.Errorf("node '%s' has no output latch register", deviceID)
+	}
+	value, err := eds.DS2408OutputValue(latch.value, actionID, on)
+	if err == nil {
+		err = binding.edsAPI.WriteData(deviceID, eds.DS2408OutputLatchState, strconv.Itoa(value))
+	}
+	if err == nil {
+		binding.mu.Lock()
+		binding.outputLatches[deviceID] = &outputLatch{value: value, written: time.Now()}
+		binding.mu.Unlock()
+	}
+	return err
+}
+
+// PublishSwitchActivity publishes an activity event for each DS2408 channel whose input
+// activity latch was set in the last poll, and clears the latches.
+// This reports short button presses that happen between polls.
+func (binding *OWServerBinding) PublishSwitchActivity(ctx context.Context, thingID string, node *eds.OneWireNode) (err error) {
+	binding.mu.Lock()
+	channels := binding.switchActivity[node.NodeID]
+	delete(binding.switchActivity, node.NodeID)
+	binding.mu.Unlock()
+	if len(channels) == 0 {
+		return nil
+	}
+	for _, ch := range channels {
+		err2 := binding.pubsub.PubEvent(ctx, thingID, eds.EventNameActivity, []byte(strconv.Itoa(ch)))
+		if err2 != nil {
+			err = err2
+		}
+	}
+	err2 := binding.edsAPI.WriteData(node.NodeID, eds.DS2408ActivityLatchRset, "1")
+	if err2 != nil {
+		logrus.Warningf("unable to clear activity latches of node '%s': %s", node.NodeID, err2)
+		err = err2
+	}
+	return err
+}
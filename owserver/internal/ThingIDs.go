@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// Placeholders of the thing ID template
+const (
+	PlaceholderBindingID  = "{bindingID}"
+	PlaceholderGatewayMAC = "{gatewayMAC}"
+	PlaceholderRomID      = "{romId}"
+)
+
+// DefaultThingIDTemplate uses the ROMId as thing ID
+const DefaultThingIDTemplate = PlaceholderRomID
+
+// formatThingID returns the thing ID of a node from the alias table or the thing ID template.
+// Virtual Things, group Things and the key reader keep their configured ID.
+func (binding *OWServerBinding) formatThingID(node *eds.OneWireNode) string {
+	// a device that replaced another device keeps the thing ID of the replaced device
+	romID := binding.configID(node.NodeID)
+	if node.ParentID != "" {
+		quantity := strings.TrimPrefix(node.NodeID, node.ParentID+"-")
+		romID = ChildThingID(binding.configID(node.ParentID), quantity)
+	}
+	if alias, found := binding.Config.Aliases[romID]; found {
+		return alias
+	}
+	if binding.isConfiguredThing(node.NodeID) {
+		return node.NodeID
+	}
+	template := binding.Config.ThingIDTemplate
+	if template == "" {
+		template = DefaultThingIDTemplate
+	}
+	// colons in the MAC would conflict with the {bindingID}:{romId} separator
+	mac := strings.ReplaceAll(binding.gatewayMAC, ":", "")
+	replacer := strings.NewReplacer(
+		PlaceholderBindingID, binding.Config.BindingID,
+		PlaceholderGatewayMAC, mac,
+		PlaceholderRomID, romID)
+	return replacer.Replace(template)
+}
+
+// isConfiguredThing returns true if the node is a Thing whose ID is set in the configuration
+func (binding *OWServerBinding) isConfiguredThing(nodeID string) bool {
+	if binding.Config.KeyReader != nil && nodeID == binding.getKeyReaderID() {
+		return true
+	}
+	for _, vt := range binding.Config.VirtualThings {
+		if vt.ThingID == nodeID {
+			return true
+		}
+	}
+	for _, group := range binding.Config.Groups {
+		if group.ThingID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// updateThingIDs records the thing ID of each polled node.
+// When the thing ID of a node changed, eg after changing the template or an alias, the
+// previous ID is kept so actions addressed to it are still routed to the node. Nodes without
+// a recorded thing ID previously used their ROMId.
+// This must be called with the lock held, and returns true if the state has changed.
+func (binding *OWServerBinding) updateThingIDs(nodes []*eds.OneWireNode) (changed bool) {
+	for _, node := range nodes {
+		if node.DeviceType == vocab.DeviceTypeGateway {
+			if mac, found := node.Attr["MACAddress"]; found {
+				binding.gatewayMAC = mac.Value
+			}
+		}
+	}
+	for _, node := range nodes {
+		thingID := binding.formatThingID(node)
+		binding.thingIDs[node.NodeID] = thingID
+		binding.thingNodes[thingID] = node.NodeID
+		prevThingID, found := binding.state.ThingIDs[node.NodeID]
+		if found && prevThingID == thingID {
+			continue
+		} else if !found {
+			// the node was published with its ROMId before the template was configured
+			prevThingID = node.NodeID
+		}
+		if prevThingID != thingID {
+			logrus.Infof("Thing ID of node '%s' changed from '%s' to '%s'", node.NodeID, prevThingID, thingID)
+			binding.state.PreviousThingIDs[prevThingID] = node.NodeID
+		}
+		binding.state.ThingIDs[node.NodeID] = thingID
+		changed = true
+	}
+	return changed
+}
+
+// ThingID returns the thing ID of a node
+func (binding *OWServerBinding) ThingID(node *eds.OneWireNode) string {
+	binding.mu.Lock()
+	defer binding.mu.Unlock()
+	if thingID, found := binding.thingIDs[node.NodeID]; found {
+		return thingID
+	}
+	return binding.formatThingID(node)
+}
+
+// NodeIDOf returns the node ID of a thing ID.
+// This accepts current and previous thing IDs, and the node ID itself.
+func (binding *OWServerBinding) NodeIDOf(thingID string) string {
+	binding.mu.Lock()
+	defer binding.mu.Unlock()
+	if nodeID, found := binding.thingNodes[thingID]; found {
+		return nodeID
+	} else if nodeID, found = binding.state.PreviousThingIDs[thingID]; found {
+		return nodeID
+	}
+	return thingID
+}
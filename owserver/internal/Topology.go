@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/hiveot/hub/lib/thing"
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+)
+
+// PropNameTopology is the gateway property with the devices on each channel
+const PropNameTopology = "topology"
+
+// EventNameTopologyChanged is the gateway event that reports devices that were added,
+// removed or moved to another channel
+const EventNameTopologyChanged = "topologyChanged"
+
+// EDS attribute names of the device channel and the gateway counts per channel
+const (
+	attrChannel                 = "Channel"
+	attrDevicesConnectedChannel = "DevicesConnectedChannel"
+	attrDataErrorsChannel       = "DataErrorsChannel"
+)
+
+// TopologyDevice describes a device on a channel of the bus
+type TopologyDevice struct {
+	ThingID string `json:"thingID"`
+	ROMId   string `json:"romId"`
+	Model   string `json:"model"`
+	// Health is the EDS health of the device, 0-7
+	Health int `json:"health"`
+	// Rejected is the number of implausible readings of the device
+	Rejected int `json:"rejected,omitempty"`
+	// Status is StatusUnavailable when the device is missing from the bus
+	Status string `json:"status,omitempty"`
+}
+
+// TopologyChannel lists the devices on a channel of the gateway
+type TopologyChannel struct {
+	Channel int `json:"channel"`
+	// DevicesConnected and DataErrors as reported by the gateway
+	DevicesConnected int              `json:"devicesConnected"`
+	DataErrors       int              `json:"dataErrors"`
+	Devices          []TopologyDevice `json:"devices"`
+}
+
+// TopologyChange describes a device that was added, removed or moved to another channel.
+// From is 0 when the device was added and To is 0 when the device was removed.
+type TopologyChange struct {
+	ThingID string `json:"thingID"`
+	ROMId   string `json:"romId"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+}
+
+// topologyChannelSchema is the data schema of the channels in the topology property
+var topologyChannelSchema = thing.DataSchema{
+	Type: vocab.WoTDataTypeObject,
+	Properties: map[string]thing.DataSchema{
+		"channel":          {Title: "Channel", Type: vocab.WoTDataTypeInteger},
+		"devicesConnected": {Title: "Devices connected", Type: vocab.WoTDataTypeInteger},
+		"dataErrors":       {Title: "Data errors", Type: vocab.WoTDataTypeInteger},
+		"devices": {Title: "Devices on the channel", Type: vocab.WoTDataTypeArray,
+			ArrayItems: thing.DataSchema{
+				Type: vocab.WoTDataTypeObject,
+				Properties: map[string]thing.DataSchema{
+					"thingID":  {Title: "Thing ID", Type: vocab.WoTDataTypeString},
+					"romId":    {Title: "ROM ID", Type: vocab.WoTDataTypeString},
+					"model":    {Title: "Model", Type: vocab.WoTDataTypeString},
+					"health":   {Title: "Health 0-7", Type: vocab.WoTDataTypeInteger},
+					"rejected": {Title: "Rejected readings", Type: vocab.WoTDataTypeInteger},
+					"status":   {Title: "Status", Type: vocab.WoTDataTypeString},
+				},
+			}},
+	},
+}
+
+// topologyChangeSchema is the data schema of the changes in the topology changed event
+var topologyChangeSchema = thing.DataSchema{
+	Type: vocab.WoTDataTypeObject,
+	Properties: map[string]thing.DataSchema{
+		"thingID": {Title: "Thing ID", Type: vocab.WoTDataTypeString},
+		"romId":   {Title: "ROM ID", Type: vocab.WoTDataTypeString},
+		"from":    {Title: "Previous channel, 0 when added", Type: vocab.WoTDataTypeInteger},
+		"to":      {Title: "New channel, 0 when removed", Type: vocab.WoTDataTypeInteger},
+	},
+}
+
+// topologyEvent is a topology change event that is waiting to be published
+type topologyEvent struct {
+	thingID string
+	changes []TopologyChange
+}
+
+// gatewayChannelCount returns the channel and count of a gateway attribute with a count per
+// channel, eg DataErrorsChannel2.
+func gatewayChannelCount(attr eds.OneWireAttr, prefix string) (channel int, count int, found bool) {
+	if !strings.HasPrefix(attr.ID, prefix) {
+		return 0, 0, false
+	}
+	channel, err := strconv.Atoi(strings.TrimPrefix(attr.ID, prefix))
+	if err != nil {
+		return 0, 0, false
+	}
+	count, _ = strconv.Atoi(attr.Value)
+	return channel, count, true
+}
+
+// UpdateTopology adds the topology property to the gateway node, listing the known devices
+// on each channel, and records a topology change event when devices were added, removed or
+// moved to another channel. Devices that are missing from the bus are listed on their last
+// known channel until they are retired.
+// This must be called with the lock held, after the presence of the nodes is updated.
+func (binding *OWServerBinding) UpdateTopology(gateway *eds.OneWireNode) {
+	channels := make(map[int]*TopologyChannel)
+	getChannel := func(ch int) *TopologyChannel {
+		tc, found := channels[ch]
+		if !found {
+			tc = &TopologyChannel{Channel: ch, Devices: make([]TopologyDevice, 0)}
+			channels[ch] = tc
+		}
+		return tc
+	}
+	for _, attr := range gateway.Attr {
+		if ch, count, found := gatewayChannelCount(attr, attrDevicesConnectedChannel); found {
+			getChannel(ch).DevicesConnected = count
+		} else if ch, count, found = gatewayChannelCount(attr, attrDataErrorsChannel); found {
+			getChannel(ch).DataErrors = count
+		}
+	}
+	deviceChannels := make(map[string]int)
+	for nodeID, node := range binding.nodes {
+		chAttr, found := node.Attr[attrChannel]
+		if !found || node.ParentID != "" {
+			continue
+		}
+		ch, err := strconv.Atoi(chAttr.Value)
+		if err != nil {
+			continue
+		}
+		deviceChannels[nodeID] = ch
+		device := TopologyDevice{
+			ThingID: binding.presenceThingID(nodeID),
+			ROMId:   nodeID,
+			Model:   node.Model,
+		}
+		device.Health, _ = strconv.Atoi(node.Attr["Health"].Value)
+		if health, found := binding.health[nodeID]; found {
+			device.Rejected = health.rejected
+		}
+		if binding.isUnavailable(nodeID) {
+			device.Status = StatusUnavailable
+		}
+		tc := getChannel(ch)
+		tc.Devices = append(tc.Devices, device)
+	}
+	topology := make([]*TopologyChannel, 0, len(channels))
+	for _, tc := range channels {
+		sort.Slice(tc.Devices, func(i, j int) bool { return tc.Devices[i].ROMId < tc.Devices[j].ROMId })
+		topology = append(topology, tc)
+	}
+	sort.Slice(topology, func(i, j int) bool { return topology[i].Channel < topology[j].Channel })
+	topologyJSON, _ := json.Marshal(topology)
+	gateway.Attr[PropNameTopology] = eds.OneWireAttr{
+		ID:          PropNameTopology,
+		Name:        "Bus topology",
+		Value:       string(topologyJSON),
+		DataType:    vocab.WoTDataTypeArray,
+		Description: "Devices on each channel with their model and health",
+	}
+
+	// the first topology after startup is not a change
+	changes := make([]TopologyChange, 0)
+	if binding.deviceChannels != nil {
+		for nodeID, ch := range deviceChannels {
+			if prevCh := binding.deviceChannels[nodeID]; prevCh != ch {
+				changes = append(changes, TopologyChange{
+					ThingID: binding.presenceThingID(nodeID), ROMId: nodeID, From: prevCh, To: ch})
+			}
+		}
+		for nodeID, prevCh := range binding.deviceChannels {
+			if _, found := deviceChannels[nodeID]; !found {
+				changes = append(changes, TopologyChange{
+					ThingID: binding.presenceThingID(nodeID), ROMId: nodeID, From: prevCh})
+			}
+		}
+	}
+	binding.deviceChannels = deviceChannels
+	if len(changes) > 0 {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].ROMId < changes[j].ROMId })
+		for _, change := range changes {
+			logrus.Infof("Topology changed: device '%s' channel %d -> %d", change.ROMId, change.From, change.To)
+		}
+		binding.topologyEvents = append(binding.topologyEvents,
+			topologyEvent{thingID: binding.presenceThingID(gateway.NodeID), changes: changes})
+	}
+}
+
+// PublishTopologyChanges publishes the pending topology change events of the gateway
+func (binding *OWServerBinding) PublishTopologyChanges(ctx context.Context) (err error) {
+	binding.mu.Lock()
+	events := binding.topologyEvents
+	binding.topologyEvents = nil
+	binding.mu.Unlock()
+
+	for _, ev := range events {
+		changesJSON, _ := json.Marshal(ev.changes)
+		err2 := binding.pubsub.PubEvent(ctx, ev.thingID, EventNameTopologyChanged, changesJSON)
+		if err2 != nil {
+			err = err2
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/bindings/owserver/internal/tdvalidate"
+)
+
+// TDContext is the JSON-LD context of the published TDs. TDs are validated against the
+// TD 1.1 schema, which requires the TD 1.1 context URI.
+const TDContext = "https://www.w3.org/2022/wot/td/v1.1"
+
+// validateTD checks a TD document before it is published.
+// Violations are logged as warnings, or returned as an error if strict validation is configured.
+func (binding *OWServerBinding) validateTD(thingID string, tdDoc []byte) error {
+	violations := tdvalidate.Validate(tdDoc)
+	if len(violations) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.String())
+	}
+	if binding.Config.StrictTDValidation {
+		return fmt.Errorf("invalid TD of '%s': %s", thingID, strings.Join(messages, "; "))
+	}
+	for _, msg := range messages {
+		logrus.Warningf("TD of '%s': %s", thingID, msg)
+	}
+	return nil
+}
+
+// ValidateSimulationTDs reads the nodes from an OWServer simulation file and validates the
+// TD of each node and of the binding.
+// This returns a list of violations prefixed with the thing ID.
+func ValidateSimulationTDs(simulationFile string) (violations []string, err error) {
+	cfg := NewBindingConfig()
+	if !strings.Contains(simulationFile, "://") {
+		simulationFile = "file://" + simulationFile
+	}
+	cfg.OWServerAddress = simulationFile
+	binding := NewOWServerBinding(cfg, nil)
+	binding.edsAPI = eds.NewEdsAPI(cfg.OWServerAddress, "", "")
+	nodes, err := binding.PollNodes()
+	if err != nil {
+		return nil, err
+	}
+	tds := []interface{}{binding.CreateBindingTD()}
+	thingIDs := []string{cfg.BindingID}
+	for _, node := range nodes {
+		tds = append(tds, binding.CreateTDFromNode(node))
+		thingIDs = append(thingIDs, binding.ThingID(node))
+	}
+	for i, td := range tds {
+		tdDoc, _ := json.Marshal(td)
+		for _, violation := range tdvalidate.Validate(tdDoc) {
+			violations = append(violations, thingIDs[i]+": "+violation.String())
+		}
+	}
+	return violations, nil
+}
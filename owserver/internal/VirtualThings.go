@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/hiveot/hub/api/go/vocab"
+
+	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/bindings/owserver/internal/expr"
+)
+
+// Validate returns an error if the virtual Thing has no thing ID or title, or if a sensor
+// has no ID or expression.
+func (cfg VirtualThingConfig) Validate() error {
+	if cfg.ThingID == "" {
+		return fmt.Errorf("virtual Thing '%s' has no thing ID", cfg.Title)
+	} else if cfg.Title == "" {
+		return fmt.Errorf("virtual Thing '%s' has no title", cfg.ThingID)
+	}
+	for _, sensor := range cfg.Sensors {
+		if sensor.ID == "" || sensor.Expression == "" {
+			return fmt.Errorf("sensor '%s' of virtual Thing '%s' needs an ID and expression",
+				sensor.Title, cfg.ThingID)
+		}
+	}
+	return nil
+}
+
+// validVirtualThings returns the virtual Things of the configuration that are valid.
+// Invalid virtual Things are logged and ignored.
+func validVirtualThings(virtualThings []VirtualThingConfig) []VirtualThingConfig {
+	valid := make([]VirtualThingConfig, 0, len(virtualThings))
+	for _, vt := range virtualThings {
+		if err := vt.Validate(); err != nil {
+			logrus.Errorf("ignoring invalid virtual Thing: %s", err)
+			continue
+		}
+		valid = append(valid, vt)
+	}
+	return valid
+}
+
+// CreateVirtualNodes computes the sensors of the configured virtual Things from the
+// values of the polled nodes, and returns a node for each virtual Thing.
+// Sensors whose expression cannot be evaluated, eg because a device is missing, have no
+// value. They keep their place in the TD so the TD doesn't change when a device is missing.
+func (binding *OWServerBinding) CreateVirtualNodes(nodes []*eds.OneWireNode) []*eds.OneWireNode {
+	if len(binding.Config.VirtualThings) == 0 {
+		return nil
+	}
+	nodeMap := make(map[string]*eds.OneWireNode)
+	for _, node := range nodes {
+		// expressions keep working when a device is replaced
+		nodeMap[binding.configID(node.NodeID)] = node
+		nodeMap[node.NodeID] = node
+	}
+	// variables are named {nodeID}.{attrID}
+	lookup := func(name string) (float64, bool) {
+		nodeID, attrID, found := strings.Cut(name, ".")
+		if !found {
+			return 0, false
+		}
+		node, found := nodeMap[nodeID]
+		if !found {
+			return 0, false
+		}
+		attr, found := node.Attr[attrID]
+		if !found || attr.Rejected {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(attr.Value, 64)
+		return value, err == nil
+	}
+
+	virtualNodes := make([]*eds.OneWireNode, 0, len(binding.Config.VirtualThings))
+	for _, vt := range binding.Config.VirtualThings {
+		deviceType := vt.DeviceType
+		if deviceType == "" {
+			deviceType = vocab.DeviceTypeSensor
+		}
+		vNode := &eds.OneWireNode{
+			NodeID:      vt.ThingID,
+			Name:        vt.Title,
+			Description: "Virtual sensors computed by the binding",
+			DeviceType:  deviceType,
+			Attr:        make(map[string]eds.OneWireAttr),
+			Alarms:      make(map[string]*eds.OneWireAlarm),
+		}
+		for _, sensor := range vt.Sensors {
+			valueStr := ""
+			value, err := expr.Eval(sensor.Expression, lookup)
+			if err != nil {
+				logrus.Warningf("virtual sensor '%s' of '%s': %s", sensor.ID, vt.ThingID, err)
+			} else {
+				valueStr = eds.RoundValue(value, sensor.Decimals)
+			}
+			vNode.Attr[sensor.ID] = eds.OneWireAttr{
+				ID:          sensor.ID,
+				Name:        sensor.Title,
+				VocabType:   sensor.VocabType,
+				Unit:        sensor.Unit,
+				Value:       valueStr,
+				IsSensor:    true,
+				DataType:    vocab.WoTDataTypeNumber,
+				Decimals:    sensor.Decimals,
+				Description: sensor.Expression,
+			}
+		}
+		virtualNodes = append(virtualNodes, vNode)
+	}
+	return virtualNodes
+}
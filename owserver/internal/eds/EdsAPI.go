@@ -57,11 +57,21 @@ var deviceTypeMap = map[string]string{
 	"42": vocab.DeviceTypeThermometer,  // DS28EA00: digital thermometer with PIO (https://www.analog.com/media/en/technical-documentation/data-sheets/ds28ea00.pdf)
 	"51": vocab.DeviceTypeIndicator,    // 2751: multi chemistry battery fuel gauge
 	"84": vocab.DeviceTypeTime,         // 2404S: dual port plus time
+	//# EDS00xx sensors share this family. The device type is determined by the model, see EdsModelVocab.
 	//# EDS0068: Temperature, Humidity, Barometric Pressure and Light Sensor
 	//https://www.embeddeddatasystems.com/assets/images/supportFiles/manuals/EN-UserMan%20%20OW-ENV%20Sensor%20v13.pdf
 	"7E": vocab.DeviceTypeMultisensor,
 }
 
+// FamilyDS1990A is the family code of DS1990A iButton serial number keys
+const FamilyDS1990A = "01"
+
+// VocabCounter is the sensor type of pulse counters
+const VocabCounter = "counter"
+
+// VocabCounterRate is the sensor type of the rate of pulse counters
+const VocabCounterRate = "counterRate"
+
 // AttrVocab maps OWServer attribute names to IoT vocabulary
 var AttrVocab = map[string]string{
 	"MACAddress": vocab.VocabMAC,
@@ -79,8 +89,6 @@ var AttrVocab = map[string]string{
 	"BarometricPressureHgLowConditionalSearchState":  "",
 	"BarometricPressureMbHighConditionalSearchState": "",
 	"BarometricPressureMbLowConditionalSearchState":  "",
-	"Counter1":                              "",
-	"Counter2":                              "",
 	"DateTime":                              "",
 	"DewPointHighConditionalSearchState":    "",
 	"DewPointLowConditionalSearchState":     "",
@@ -88,8 +96,10 @@ var AttrVocab = map[string]string{
 	"HeatIndexLowConditionalSearchState":    "",
 	"Humidex":                               "",
 	"HumidexHighAlarmState":                 "",
+	"HumidexHighAlarmValue":                 "",
 	"HumidexHighConditionalSearchState":     "",
 	"HumidexLowAlarmState":                  "",
+	"HumidexLowAlarmValue":                  "",
 	"HumidexLowConditionalSearchState":      "",
 	"HumidityHighConditionalSearchState":    "",
 	"HumidityLowConditionalSearchState":     "",
@@ -102,38 +112,69 @@ var AttrVocab = map[string]string{
 	"RawData":                               "",
 }
 
-// SensorTypeVocab maps OWServer sensor names to IoT vocabulary
-var SensorTypeVocab = map[string]struct {
+// sensorTypeInfo describes a known sensor
+type sensorTypeInfo struct {
 	sensorType string // sensor type from vocabulary
 	name       string
 	dataType   string
 	decimals   int // number of decimals accuracy for this value
-}{
+}
+
+// SensorTypeVocab maps OWServer sensor names to IoT vocabulary
+var SensorTypeVocab = map[string]sensorTypeInfo{
 	// "BarometricPressureHg": vocab.PropNameAtmosphericPressure, // unit Hg
-	"BarometricPressureMb":               {sensorType: vocab.VocabAtmosphericPressure, name: "Atmospheric Pressure", dataType: vocab.WoTDataTypeNumber, decimals: 0}, // unit Mb
-	"BarometricPressureMbHighAlarmState": {sensorType: vocab.VocabAlarmState, name: "Pressure High Alarm", dataType: vocab.WoTDataTypeBool},
-	"BarometricPressureMbLowAlarmState":  {sensorType: vocab.VocabAlarmState, name: "Pressure Low Alarm", dataType: vocab.WoTDataTypeBool},
-	"DewPoint":                           {sensorType: vocab.VocabDewpoint, name: "Dew point", dataType: vocab.WoTDataTypeNumber, decimals: 1},
-	"Health":                             {sensorType: "health", name: "Health 0-7", dataType: vocab.WoTDataTypeNumber},
-	"HeatIndex":                          {sensorType: vocab.VocabHeatIndex, name: "Heat Index", dataType: vocab.WoTDataTypeNumber, decimals: 1},
-	"Humidity":                           {sensorType: vocab.VocabHumidity, name: "Humidity", dataType: vocab.WoTDataTypeNumber, decimals: 0},
-	"HumidityHighAlarmState":             {sensorType: vocab.VocabAlarmState, name: "Humidity High Alarm", dataType: vocab.WoTDataTypeBool},
-	"HumidityLowAlarmState":              {sensorType: vocab.VocabAlarmState, name: "Humidity Low Alarm", dataType: vocab.WoTDataTypeBool},
-	"Light":                              {sensorType: vocab.VocabLuminance, name: "Luminance", dataType: vocab.WoTDataTypeNumber, decimals: 0},
-	"RelayState":                         {sensorType: vocab.VocabRelay, name: "Relay State", dataType: vocab.WoTDataTypeBool, decimals: 0},
-	"Temperature":                        {sensorType: vocab.VocabTemperature, name: "Temperature", dataType: vocab.WoTDataTypeNumber, decimals: 1},
-	"TemperatureHighAlarmState":          {sensorType: vocab.VocabAlarmState, name: "Temperature High Alarm", dataType: vocab.WoTDataTypeBool},
-	"TemperatureLowAlarmState":           {sensorType: vocab.VocabAlarmState, name: "Temperature Low Alarm", dataType: vocab.WoTDataTypeBool},
+	"BarometricPressureMb": {sensorType: vocab.VocabAtmosphericPressure, name: "Atmospheric Pressure", dataType: vocab.WoTDataTypeNumber, decimals: 0}, // unit Mb
+	"DewPoint":             {sensorType: vocab.VocabDewpoint, name: "Dew point", dataType: vocab.WoTDataTypeNumber, decimals: 1},
+	"Health":               {sensorType: "health", name: "Health 0-7", dataType: vocab.WoTDataTypeInteger},
+	"HeatIndex":            {sensorType: vocab.VocabHeatIndex, name: "Heat Index", dataType: vocab.WoTDataTypeNumber, decimals: 1},
+	"Humidity":             {sensorType: vocab.VocabHumidity, name: "Humidity", dataType: vocab.WoTDataTypeNumber, decimals: 0},
+	"Light":                {sensorType: vocab.VocabLuminance, name: "Luminance", dataType: vocab.WoTDataTypeNumber, decimals: 0},
+	"LED":                  {sensorType: VocabLED, name: "LED", dataType: vocab.WoTDataTypeBool, decimals: 0},
+	"Relay":                {sensorType: vocab.VocabRelay, name: "Relay", dataType: vocab.WoTDataTypeBool, decimals: 0},
+	"Temperature":          {sensorType: vocab.VocabTemperature, name: "Temperature", dataType: vocab.WoTDataTypeNumber, decimals: 1},
 }
 
-// ActuatorTypeVocab maps OWServer names to IoT vocabulary
-var ActuatorTypeVocab = map[string]struct {
+// configInfo describes the allowed values of a configuration attribute
+type configInfo struct {
+	title      string
+	unit       string   // unit of the value if the gateway doesn't report one
+	min        float64  // minimum allowed value
+	max        float64  // maximum allowed value
+	enum       []string // allowed values, if restricted
+	enumTitles []string // titles of the allowed values
+}
+
+// ConfigVocab maps OWServer configuration names to a title and allowed value range.
+// The range and allowed values also apply to sensors of the same name.
+var ConfigVocab = map[string]configInfo{
+	"Health":   {title: "Health", min: 0, max: 7, enum: []string{"0", "1", "2", "3", "4", "5", "6", "7"}},
+	"Humidity": {title: "Humidity", min: 0, max: 100},
+}
+
+// CounterVocab maps OWServer pulse counter names to a title.
+// Counters are monotonic and are scaled by the binding using the counter configuration.
+var CounterVocab = map[string]string{
+	"Counter1": "Counter 1", // EDS00xx counters
+	"Counter2": "Counter 2",
+	"CounterA": "Counter A", // DS2423 counters
+	"CounterB": "Counter B",
+}
+
+// actuatorTypeInfo describes a known actuator
+type actuatorTypeInfo struct {
 	actuatorType string // sensor type from vocabulary
 	title        string
 	dataType     string
-}{
+	actionID     string // action ID if different from the EDS name
+	functionID   string // function attribute that must be set to manual to accept writes
+}
+
+// ActuatorTypeVocab maps OWServer names to IoT vocabulary
+var ActuatorTypeVocab = map[string]actuatorTypeInfo{
 	// "BarometricPressureHg": vocab.PropNameAtmosphericPressure, // unit Hg
-	"Relay": {actuatorType: vocab.VocabRelay, title: "Relay", dataType: vocab.WoTDataTypeBool},
+	"ClearAlarms": {actuatorType: ActionClearAlarms, title: "Clear Alarms", dataType: vocab.WoTDataTypeNone, actionID: ActionClearAlarms},
+	"LEDState":    {actuatorType: VocabLED, title: "LED", dataType: vocab.WoTDataTypeBool, actionID: VocabLED, functionID: "LEDFunction"},
+	"RelayState":  {actuatorType: vocab.VocabRelay, title: "Relay", dataType: vocab.WoTDataTypeBool, actionID: vocab.VocabRelay, functionID: "RelayFunction"},
 }
 
 // UnitNameVocab maps OWServer unit names to IoT vocabulary
@@ -146,6 +187,7 @@ var UnitNameVocab = map[string]string{
 	"Lux":                     vocab.UnitNameLux,
 	"//":                      vocab.UnitNameCount,
 	"Volt":                    vocab.UnitNameVolt,
+	"Volts":                   vocab.UnitNameVolt,
 }
 
 // EdsAPI EDS device API properties and methods
@@ -172,15 +214,24 @@ type XMLNode struct {
 
 // OneWireAttr with info on each node attribute, property, event or action
 type OneWireAttr struct {
-	ID         string // attribute raw instance ID
-	Name       string // attribute title for humans
-	VocabType  string // attribute type from vocabulary, if any, eg 'temperature', ...
-	Unit       string
-	Writable   bool
-	Value      string
-	IsActuator bool
-	IsSensor   bool   // sensors emit events on change
-	DataType   string // vocab data type, "string", "number", "boolean", ""
+	ID          string // attribute raw instance ID, used as the EDS variable name
+	Name        string // attribute title for humans
+	VocabType   string // attribute type from vocabulary, if any, eg 'temperature', ...
+	Unit        string
+	Writable    bool
+	Value       string
+	IsActuator  bool
+	IsSensor    bool     // sensors emit events on change
+	IsCounter   bool     // monotonic pulse counter sensor
+	DataType    string   // vocab data type, "string", "number", "boolean", ""
+	Min         float64  // minimum value of numeric attributes, if Min < Max
+	Max         float64  // maximum value of numeric attributes, if Min < Max
+	Enum        []string // allowed values, if restricted
+	EnumTitles  []string // titles of the allowed values, if named
+	RawValue    string   // value as reported by the gateway, before rounding
+	Decimals    int      // number of decimals the value is rounded to, -1 for no rounding
+	Description string   // optional description of the attribute
+	Rejected    bool     // the value failed the plausibility check and is not published
 }
 
 // OneWireNode with info on each node
@@ -188,9 +239,13 @@ type OneWireNode struct {
 	DeviceType string
 	// ThingID     string
 	NodeID      string // ROM ID
+	Family      string // 1-wire family code, eg "28"
+	Model       string // device model from the Name element, eg "EDS0068"
 	Name        string
 	Description string
-	Attr        map[string]OneWireAttr // attribute by ID
+	Attr        map[string]OneWireAttr   // attribute by affordance ID
+	Alarms      map[string]*OneWireAlarm // hardware alarms by alarm ID
+	ParentID    string                   // ROM ID of the device of a child Thing, if split
 }
 
 // Apply the vocabulary to the name
@@ -203,6 +258,13 @@ func applyVocabulary(name string, vocab map[string]string) (vocabName string, ha
 	return vocabName, hasName
 }
 
+// RoundValue rounds a value to the given number of decimals and returns it as a string
+func RoundValue(value float64, decimals int) string {
+	ratio := math.Pow(10, float64(decimals))
+	value = math.Round(value*ratio) / ratio
+	return strconv.FormatFloat(value, 'f', decimals, 32)
+}
+
 // Discover any EDS OWServer ENet-2 on the local network for 3 seconds
 // This uses a UDP Broadcast on port 30303 as stated in the manual
 // If found, this sets the service address for further use
@@ -267,6 +329,7 @@ func ParseOneWireNodes(
 		Name:        xmlNode.XMLName.Local,
 		Description: xmlNode.Description,
 		Attr:        make(map[string]OneWireAttr),
+		Alarms:      make(map[string]*OneWireAlarm),
 		DeviceType:  vocab.DeviceTypeGateway,
 	}
 	owNodeList = append(owNodeList, &owNode)
@@ -278,9 +341,16 @@ func ParseOneWireNodes(
 			Value:    fmt.Sprintf("%.2f", latency.Seconds()),
 			Unit:     "sec",
 			DataType: vocab.WoTDataTypeNumber,
+			Decimals: 2,
 		}
 		owNode.Attr[owAttr.Name] = owAttr
 	}
+	// the model determines which sensors, actuators and alarms the node has
+	for _, node := range xmlNode.Nodes {
+		if len(node.Nodes) == 0 && node.XMLName.Local == "Name" {
+			owNode.Model = string(node.Content)
+		}
+	}
 	// parse attributes and round sensor values
 	for _, node := range xmlNode.Nodes {
 		// if the xmlnode has no subnodes then it is a parameter describing the current node
@@ -288,40 +358,91 @@ func ParseOneWireNodes(
 			// standardize the naming of properties and property types
 			writable := strings.ToLower(node.Writable) == "true"
 			attrID := node.XMLName.Local
+			affordanceID := attrID
 			title := attrID
-			actuatorInfo, isActuator := ActuatorTypeVocab[attrID]
-			sensorInfo, isSensor := SensorTypeVocab[attrID]
+			actuatorInfo, isActuator := lookupActuator(owNode.Model, attrID)
+			sensorInfo, isSensor := lookupSensor(owNode.Model, attrID)
+			counterTitle, isCounter := CounterVocab[attrID]
+			alarmQuantity, alarmLimit, alarmSuffix, isAlarm := parseAlarmID(attrID)
+			isAlarm = isAlarm && modelHasAlarm(owNode.Model, alarmQuantity)
 			vocabType := "" // standardized type, if known
+			erased := false // the vocabulary erases the attribute
 			decimals := -1  // -1 means no conversion
 			dataType := vocab.WoTDataTypeString
+			minValue, maxValue := 0.0, 0.0
+			var enum, enumTitles []string
+			defaultUnit := ""
 
 			if isActuator {
 				// this is a known actuator type
 				title = actuatorInfo.title
 				vocabType = actuatorInfo.actuatorType
 				dataType = actuatorInfo.dataType
+				if actuatorInfo.actionID != "" {
+					affordanceID = actuatorInfo.actionID
+				}
+			} else if isAlarm {
+				// alarm states and thresholds are properties that are grouped into alarms
+				title = alarmTitle(alarmQuantity, alarmLimit, alarmSuffix)
+				vocabType = VocabAlarmThreshold
+				if alarmSuffix == "AlarmState" {
+					vocabType = vocab.VocabAlarmState
+				} else {
+					quantityInfo, _ := lookupSensor(owNode.Model, alarmQuantity)
+					decimals = quantityInfo.decimals
+					minValue = AlarmVocab[alarmQuantity].min
+					maxValue = AlarmVocab[alarmQuantity].max
+				}
+				dataType = alarmDataType(alarmSuffix)
+			} else if isCounter {
+				// counters are sensors with a raw pulse count
+				title = counterTitle
+				vocabType = VocabCounter
+				dataType = vocab.WoTDataTypeNumber
+				isSensor = true
 			} else if isSensor {
 				// this is a known sensor type
 				title = sensorInfo.name
 				vocabType = sensorInfo.sensorType
 				decimals = sensorInfo.decimals
 				dataType = sensorInfo.dataType
+				if cfgInfo, hasRange := ConfigVocab[attrID]; hasRange {
+					minValue, maxValue = cfgInfo.min, cfgInfo.max
+					enum = cfgInfo.enum
+					enumTitles = cfgInfo.enumTitles
+				}
 			} else {
 				// this is an attribute, or configuration when writable
-				vocabType, _ = applyVocabulary(attrID, AttrVocab)
+				// names that aren't in the vocabulary have no standardized type
+				var hasName bool
+				vocabType, hasName = applyVocabulary(attrID, AttrVocab)
+				if !hasName {
+					vocabType = ""
+				}
+				erased = hasName && vocabType == ""
+				if cfgInfo, isConfig := ConfigVocab[attrID]; isConfig {
+					title = cfgInfo.title
+					defaultUnit = cfgInfo.unit
+					minValue = cfgInfo.min
+					maxValue = cfgInfo.max
+					enum = cfgInfo.enum
+					enumTitles = cfgInfo.enumTitles
+				}
 			}
 			// ignore values erased in the vocabulary
-			if vocabType != "" {
+			if !erased {
 				unit, _ := applyVocabulary(node.Units, UnitNameVocab)
+				if unit == "" {
+					unit = defaultUnit
+				}
 				valueStr := string(node.Content)
 				valueFloat, err := strconv.ParseFloat(valueStr, 32)
 				// if it can be parsed then it is a number
-				if err == nil && dataType != vocab.WoTDataTypeBool {
+				if err == nil && dataType != vocab.WoTDataTypeBool && dataType != vocab.WoTDataTypeNone &&
+					dataType != vocab.WoTDataTypeInteger {
 					// rounding of sensor values to decimals
 					if decimals >= 0 {
-						ratio := math.Pow(10, float64(decimals))
-						valueFloat = math.Round(valueFloat*ratio) / ratio
-						valueStr = strconv.FormatFloat(valueFloat, 'f', decimals, 32)
+						valueStr = RoundValue(valueFloat, decimals)
 					}
 					dataType = vocab.WoTDataTypeNumber
 				}
@@ -331,15 +452,26 @@ func ParseOneWireNodes(
 					Name:       title,
 					VocabType:  vocabType,
 					Value:      valueStr,
+					RawValue:   string(node.Content),
+					Decimals:   decimals,
 					Unit:       unit,
 					IsSensor:   isSensor,
+					IsCounter:  isCounter,
 					IsActuator: isActuator,
 					Writable:   writable,
 					DataType:   dataType,
+					Min:        minValue,
+					Max:        maxValue,
+					Enum:       enum,
+					EnumTitles: enumTitles,
+				}
+				owNode.Attr[affordanceID] = owAttr
+				if isAlarm {
+					owNode.addAlarmAttr(alarmQuantity, alarmLimit, alarmSuffix, owAttr)
 				}
-				owNode.Attr[owAttr.ID] = owAttr
 				// Family is used to determine device type, default is gateway
 				if node.XMLName.Local == "Family" {
+					owNode.Family = owAttr.Value
 					deviceType := deviceTypeMap[owAttr.Value]
 					if deviceType == "" {
 						deviceType = vocab.DeviceTypeUnknown
@@ -361,6 +493,25 @@ func ParseOneWireNodes(
 			owNodeList = append(owNodeList, subNodes...)
 		}
 	}
+	// the family is decoded from the ROM when the gateway doesn't report it
+	if !isRootNode && owNode.Family == "" {
+		if family, err := ParseROMId(owNode.NodeID); err == nil {
+			owNode.Family = family
+			owNode.DeviceType = deviceTypeMap[family]
+			if owNode.DeviceType == "" {
+				owNode.DeviceType = vocab.DeviceTypeUnknown
+			}
+		}
+	}
+	if owNode.Family == FamilyDS18B20 {
+		ds18b20Attributes(&owNode)
+	} else if modelInfo, found := EdsModelVocab[owNode.Model]; found {
+		owNode.DeviceType = modelInfo.deviceType
+	}
+	// nodes with a missing or corrupt ROM ID would produce bogus Things
+	if isRootNode {
+		owNodeList = validateNodes(owNodeList)
+	}
 	// owNode.ThingID = td.CreatePublisherThingID(pb.hubConfig.Zone, PluginID, owNode.NodeID, owNode.DeviceType)
 
 	return owNodeList
@@ -1,12 +1,14 @@
 package eds_test
 
 import (
+	"encoding/xml"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/hiveot/bindings/owserver/internal/eds"
+	"github.com/hiveot/hub/api/go/vocab"
 )
 
 // simulation file for testing without OWServer gateway
@@ -72,6 +74,13 @@ func TestParseNodeFile(t *testing.T) {
 	// The test file has hub parameters and 3 connected nodes
 	deviceNodes := eds.ParseOneWireNodes(rootNode, 0, true)
 	assert.Lenf(t, deviceNodes, 4, "Expected 4 nodes")
+
+	// attributes that aren't in the vocabulary have no @type
+	for _, node := range deviceNodes {
+		if attr, found := node.Attr["PollCount"]; found {
+			assert.Empty(t, attr.VocabType)
+		}
+	}
 }
 
 // TestPollValues reads the EDS and extracts property values of each node
@@ -92,3 +101,316 @@ func TestWriteDataFail(t *testing.T) {
 	err := edsAPI.WriteData("badRomID", "temp", "")
 	assert.Error(t, err)
 }
+
+// Parse the hardware alarms of the EDS0068 in the simulation file
+func TestParseAlarms(t *testing.T) {
+	const edsNodeID = "C100100000267C7E"
+	address := "file://" + owserverSimulation
+	rootNode, err := eds.ReadEds(address, "", "")
+	require.NoError(t, err)
+
+	deviceNodes := eds.ParseOneWireNodes(rootNode, 0, true)
+	var edsNode *eds.OneWireNode
+	for _, node := range deviceNodes {
+		if node.NodeID == edsNodeID {
+			edsNode = node
+		}
+	}
+	require.NotNil(t, edsNode)
+	alarm, found := edsNode.Alarms["TemperatureHigh"]
+	require.True(t, found)
+	assert.Equal(t, "Temperature", alarm.Quantity)
+	assert.Equal(t, eds.AlarmLimitHigh, alarm.Limit)
+	assert.Equal(t, "125.0", alarm.Threshold)
+	assert.False(t, alarm.Active)
+
+	threshold := edsNode.Attr["TemperatureHighAlarmValue"]
+	assert.True(t, threshold.Writable)
+	assert.Equal(t, float64(-40), threshold.Min)
+	assert.Equal(t, float64(125), threshold.Max)
+
+	// humidex alarms are ignored
+	_, found = edsNode.Alarms["HumidexHigh"]
+	assert.False(t, found)
+
+	clearAlarms, found := edsNode.Attr[eds.ActionClearAlarms]
+	require.True(t, found)
+	assert.True(t, clearAlarms.IsActuator)
+	assert.Equal(t, "ClearAlarms", clearAlarms.ID)
+}
+
+// DS2408 channels are derived from the PIO registers
+func TestDS2408Channels(t *testing.T) {
+	node := &eds.OneWireNode{
+		NodeID: "1B00000012345629",
+		Family: eds.FamilyDS2408,
+		Attr: map[string]eds.OneWireAttr{
+			eds.DS2408LogicState:       {ID: eds.DS2408LogicState, Value: "5"},
+			eds.DS2408OutputLatchState: {ID: eds.DS2408OutputLatchState, Value: "254"},
+			eds.DS2408ActivityLatch:    {ID: eds.DS2408ActivityLatch, Value: "4"},
+		},
+	}
+	assert.Equal(t, []int{3}, eds.DS2408ActiveChannels(node))
+	outputLatch, found := eds.DS2408OutputLatch(node)
+	assert.True(t, found)
+	assert.Equal(t, 254, outputLatch)
+
+	eds.DS2408AddChannels(node, []int{1, 2})
+	assert.Equal(t, "1", node.Attr["channel1"].Value)
+	assert.Equal(t, "0", node.Attr["channel2"].Value)
+	assert.Equal(t, "1", node.Attr["channel3"].Value)
+	assert.True(t, node.Attr["channel8"].IsSensor)
+	// output 1 latch bit is 0 so the output is on
+	assert.Equal(t, "1", node.Attr["output1"].Value)
+	assert.Equal(t, "0", node.Attr["output2"].Value)
+	_, found = node.Attr["output3"]
+	assert.False(t, found)
+	// the raw registers are replaced by the channels
+	_, found = node.Attr[eds.DS2408OutputLatchState]
+	assert.False(t, found)
+
+	value, err := eds.DS2408OutputValue(outputLatch, "output2", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 252, value)
+	value, err = eds.DS2408OutputValue(value, "output1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 253, value)
+	_, err = eds.DS2408OutputValue(outputLatch, "output9", false)
+	assert.Error(t, err)
+}
+
+// DS2450 inputs are sensors and its conversion settings have a range
+func TestParseDS2450(t *testing.T) {
+	const ds2450XML = `<Devices-Detail-Response>
+<DeviceName>test</DeviceName>
+<owd_DS2450 Description="Quad A/D converter">
+<Name>DS2450</Name>
+<Family>20</Family>
+<ROMId>D700000012345620</ROMId>
+<ChannelAConversionValue Units="Volts">2.50012</ChannelAConversionValue>
+<ChannelAConversionRange Writable="True">5.12</ChannelAConversionRange>
+<ChannelAConversionResolution Writable="True">16</ChannelAConversionResolution>
+</owd_DS2450>
+</Devices-Detail-Response>`
+	var rootNode eds.XMLNode
+	err := xml.Unmarshal([]byte(ds2450XML), &rootNode)
+	require.NoError(t, err)
+	deviceNodes := eds.ParseOneWireNodes(&rootNode, 0, true)
+	require.Len(t, deviceNodes, 2)
+	node := deviceNodes[1]
+	assert.Equal(t, eds.FamilyDS2450, node.Family)
+
+	input := node.Attr[eds.DS2450InputID("A")]
+	assert.True(t, input.IsSensor)
+	assert.Equal(t, "2.500", input.Value)
+	assert.Equal(t, eds.VocabVoltage, input.VocabType)
+
+	resolution := node.Attr["ChannelAConversionResolution"]
+	assert.True(t, resolution.Writable)
+	assert.Equal(t, float64(16), resolution.Max)
+	// the conversion range is either 2.56 or 5.12 volt
+	convRange := node.Attr["ChannelAConversionRange"]
+	assert.Equal(t, []string{"2.56", "5.12"}, convRange.Enum)
+	assert.Equal(t, vocab.UnitNameVolt, convRange.Unit)
+	assert.Equal(t, "Input A range", convRange.Name)
+}
+
+func TestROMValidation(t *testing.T) {
+	family, err := eds.ParseROMId("2A000003BB170B28")
+	assert.NoError(t, err)
+	assert.Equal(t, eds.FamilyDS18B20, family)
+	_, err = eds.ParseROMId("2A000003BB170B29")
+	assert.Error(t, err)
+	_, err = eds.ParseROMId("2A0003BB170B28")
+	assert.Error(t, err)
+
+	// nodes with a typo in the ROM, a family mismatch or without ROM are rejected
+	const romXML = `<Devices-Detail-Response>
+<DeviceName>test</DeviceName>
+<owd_DS18B20 Description="Valid">
+<Family>28</Family>
+<ROMId>2A000003BB170B28</ROMId>
+</owd_DS18B20>
+<owd_DS18B20 Description="Typo">
+<Family>28</Family>
+<ROMId>2A000003BB170C28</ROMId>
+</owd_DS18B20>
+<owd_DS18B20 Description="Wrong family">
+<Family>26</Family>
+<ROMId>49000001BCEAD428</ROMId>
+</owd_DS18B20>
+<owd_DS18B20 Description="No ROM">
+<Family>28</Family>
+</owd_DS18B20>
+<owd_DS18B20 Description="No family">
+<ROMId>49000001BCEAD428</ROMId>
+</owd_DS18B20>
+</Devices-Detail-Response>`
+	var rootNode eds.XMLNode
+	err = xml.Unmarshal([]byte(romXML), &rootNode)
+	require.NoError(t, err)
+	deviceNodes := eds.ParseOneWireNodes(&rootNode, 0, true)
+	require.Len(t, deviceNodes, 3)
+	assert.Equal(t, "3", deviceNodes[0].Attr[eds.AttrInvalidNodes].Value)
+	// the family is decoded from the ROM
+	assert.Equal(t, eds.FamilyDS18B20, deviceNodes[2].Family)
+}
+
+// HIH humidity is computed from VAD, VDD and temperature, and current from Vsense
+func TestHIHHumidity(t *testing.T) {
+	node := &eds.OneWireNode{
+		Family:     eds.FamilyDS2438,
+		DeviceType: vocab.DeviceTypeBatteryMon,
+		Attr: map[string]eds.OneWireAttr{
+			eds.DS2438VAD:    {Value: "2.39"},
+			eds.DS2438VDD:    {Value: "5.00"},
+			eds.DS2438Vsense: {Value: "0.0125"},
+			"Temperature":    {Value: "25.0"},
+		},
+	}
+	eds.DS2438AddHumidity(node)
+	humidity, found := node.Attr[eds.DS2438HumidityID]
+	require.True(t, found)
+	assert.True(t, humidity.IsSensor)
+	assert.Equal(t, "51.3", humidity.Value)
+	assert.Equal(t, vocab.DeviceTypeBatteryMon, node.DeviceType)
+
+	// current through the default 0.05 Ohm sense resistor
+	eds.DS2438AddCurrent(node, 0)
+	assert.Equal(t, "0.250", node.Attr[eds.DS2438CurrentID].Value)
+	eds.DS2438AddCurrent(node, 0.025)
+	assert.Equal(t, "0.500", node.Attr[eds.DS2438CurrentID].Value)
+
+	assert.Equal(t, float64(0), eds.HIHHumidity(0.1, 5, 20))
+	assert.Equal(t, float64(0), eds.HIHHumidity(2, 0, 20))
+}
+
+// DS18B20 resolution, power source and TH/TL are converted
+func TestParseDS18B20(t *testing.T) {
+	const nodeID = "2A000003BB170B28"
+	address := "file://" + owserverSimulation
+	rootNode, err := eds.ReadEds(address, "", "")
+	require.NoError(t, err)
+	deviceNodes := eds.ParseOneWireNodes(rootNode, 0, true)
+	var node *eds.OneWireNode
+	for _, n := range deviceNodes {
+		if n.NodeID == nodeID {
+			node = n
+		}
+	}
+	require.NotNil(t, node)
+	resolution := node.Attr[eds.DS18B20Resolution]
+	// the simulated gateway doesn't support changing the resolution
+	assert.False(t, resolution.Writable)
+	assert.Len(t, resolution.Enum, 4)
+	assert.NotEmpty(t, resolution.Description)
+
+	parasite, found := node.Attr[eds.DS18B20ParasitePowerID]
+	require.True(t, found)
+	assert.Equal(t, "0", parasite.Value)
+
+	th, found := node.Attr["TemperatureHighAlarmValue"]
+	require.True(t, found)
+	assert.Equal(t, eds.DS18B20TH, th.ID)
+	assert.Equal(t, "75", th.Value)
+	_, found = node.Attr[eds.DS18B20TH]
+	assert.False(t, found)
+	// TH and TL are hardware alarms. The simulation has the factory defaults TH 75 and TL 70,
+	// so the alarms are not in use.
+	require.Len(t, node.Alarms, 2)
+	assert.Equal(t, "75", node.Alarms["TemperatureHigh"].Threshold)
+	assert.False(t, node.Alarms["TemperatureHigh"].Active)
+	assert.False(t, node.Alarms["TemperatureLow"].Active)
+
+	// deliberately set thresholds of TL 21 and TH 30 put 20.375°C in low alarm
+	const ds18b20XML = `<Devices-Detail-Response>
+<owd_DS18B20 Description="Programmable resolution thermometer">
+<Name>DS18B20</Name>
+<Family>28</Family>
+<ROMId>2A000003BB170B28</ROMId>
+<Temperature Units="Centigrade">20.3750</Temperature>
+<UserByte1 Writable="True">30</UserByte1>
+<UserByte2 Writable="True">21</UserByte2>
+</owd_DS18B20>
+</Devices-Detail-Response>`
+	var setNode eds.XMLNode
+	err = xml.Unmarshal([]byte(ds18b20XML), &setNode)
+	require.NoError(t, err)
+	setNodes := eds.ParseOneWireNodes(&setNode, 0, true)
+	require.Len(t, setNodes, 2)
+	assert.False(t, setNodes[1].Alarms["TemperatureHigh"].Active)
+	assert.True(t, setNodes[1].Alarms["TemperatureLow"].Active)
+
+	value, err := eds.DS18B20ThresholdValue("-10")
+	assert.NoError(t, err)
+	assert.Equal(t, "246", value)
+	value, err = eds.DS18B20ThresholdValue("24.6")
+	assert.NoError(t, err)
+	assert.Equal(t, "25", value)
+	_, err = eds.DS18B20ThresholdValue("200")
+	assert.Error(t, err)
+}
+
+// EDS0068 relay and LED only accept writes when under manual control
+func TestEDS0068Functions(t *testing.T) {
+	const edsNodeID = "C100100000267C7E"
+	address := "file://" + owserverSimulation
+	rootNode, err := eds.ReadEds(address, "", "")
+	require.NoError(t, err)
+	var edsNode *eds.OneWireNode
+	for _, node := range eds.ParseOneWireNodes(rootNode, 0, true) {
+		if node.NodeID == edsNodeID {
+			edsNode = node
+		}
+	}
+	require.NotNil(t, edsNode)
+
+	relayFunction := edsNode.Attr["RelayFunction"]
+	assert.Len(t, relayFunction.Enum, 4)
+	assert.Len(t, relayFunction.EnumTitles, 4)
+
+	relay, found := edsNode.Attr["relay"]
+	require.True(t, found)
+	assert.Equal(t, "RelayState", relay.ID)
+	assert.True(t, relay.IsActuator)
+	// relay function is 0 in the simulation
+	assert.Error(t, eds.ActuatorEnabled(edsNode, relay))
+
+	relayFunction.Value = eds.EdsFunctionManual
+	edsNode.Attr["RelayFunction"] = relayFunction
+	assert.NoError(t, eds.ActuatorEnabled(edsNode, relay))
+
+	// the relay element is the read-only relay state
+	assert.True(t, edsNode.Attr["Relay"].IsSensor)
+	assert.False(t, edsNode.Attr["Relay"].IsActuator)
+}
+
+// The EDS model determines the device type and affordances
+func TestParseEdsModel(t *testing.T) {
+	const eds0070XML = `<Devices-Detail-Response>
+<DeviceName>test</DeviceName>
+<owd_EDS0070 Description="Vibration Sensor">
+<Name>EDS0070</Name>
+<Family>7E</Family>
+<ROMId>C100100000267C7E</ROMId>
+<VibrationInstant>120</VibrationInstant>
+<VibrationPeak>300</VibrationPeak>
+<VibrationInstantHighAlarmValue Writable="True">1000</VibrationInstantHighAlarmValue>
+<TemperatureHighAlarmState>0</TemperatureHighAlarmState>
+</owd_EDS0070>
+</Devices-Detail-Response>`
+	var rootNode eds.XMLNode
+	err := xml.Unmarshal([]byte(eds0070XML), &rootNode)
+	require.NoError(t, err)
+	deviceNodes := eds.ParseOneWireNodes(&rootNode, 0, true)
+	require.Len(t, deviceNodes, 2)
+	node := deviceNodes[1]
+	assert.Equal(t, "EDS0070", node.Model)
+	assert.Equal(t, eds.DeviceTypeVibration, node.DeviceType)
+	assert.True(t, node.Attr["VibrationPeak"].IsSensor)
+	_, found := node.Alarms["VibrationInstantHigh"]
+	assert.True(t, found)
+	// the EDS0070 has no temperature alarm
+	_, found = node.Alarms["TemperatureHigh"]
+	assert.False(t, found)
+}
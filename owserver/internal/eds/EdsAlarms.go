@@ -0,0 +1,126 @@
+package eds
+
+import (
+	"strings"
+
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// ActionClearAlarms is the action ID of the EDS 'ClearAlarms' command
+const ActionClearAlarms = "clearAlarms"
+
+// VocabAlarmThreshold is the property type of alarm threshold values
+const VocabAlarmThreshold = "alarmThreshold"
+
+// EventNameAlarm is the event ID that is emitted when an alarm state changes
+const EventNameAlarm = "alarm"
+
+// Alarm limit names as used in the alarm event
+const (
+	AlarmLimitHigh = "high"
+	AlarmLimitLow  = "low"
+)
+
+// AlarmVocab maps the quantity of EDS hardware alarms to a title and the valid threshold range
+// Quantities that are not listed here, eg Humidex, are ignored.
+var AlarmVocab = map[string]struct {
+	title string  // title of the quantity
+	min   float64 // minimum threshold value
+	max   float64 // maximum threshold value
+}{
+	"BarometricPressureMb": {title: "Pressure", min: 0, max: 2000},
+	"DewPoint":             {title: "Dew Point", min: -40, max: 125},
+	"HeatIndex":            {title: "Heat Index", min: -40, max: 125},
+	"Humidity":             {title: "Humidity", min: 0, max: 100},
+	"Light":                {title: "Light", min: 0, max: 100000},
+	"Pressure":             {title: "Pressure", min: 0, max: 10000},
+	"Temperature":          {title: "Temperature", min: -40, max: 125},
+	"VibrationInstant":     {title: "Vibration", min: 0, max: 65535},
+}
+
+// OneWireAlarm describes a hardware alarm of a node, combining its state and threshold
+type OneWireAlarm struct {
+	ID        string // alarm ID, eg TemperatureHigh
+	Quantity  string // attribute ID of the quantity that is monitored, eg Temperature
+	Limit     string // AlarmLimitHigh or AlarmLimitLow
+	Active    bool   // the alarm is currently triggered
+	Threshold string // threshold value that triggers the alarm
+	Unit      string // unit of the threshold value
+}
+
+// AlarmEvent is the payload of the alarm event, published when an alarm state changes
+type AlarmEvent struct {
+	Quantity  string  `json:"quantity"`
+	Limit     string  `json:"limit"`
+	Active    bool    `json:"active"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Unit      string  `json:"unit,omitempty"`
+}
+
+// parseAlarmID splits an EDS alarm attribute name into the quantity, limit and suffix.
+// For example, "TemperatureHighAlarmValue" returns "Temperature", "high", "AlarmValue".
+// This returns false if the attribute is not an alarm of a known quantity.
+func parseAlarmID(attrID string) (quantity string, limit string, suffix string, isAlarm bool) {
+	for _, suffix = range []string{"AlarmState", "AlarmValue"} {
+		if !strings.HasSuffix(attrID, suffix) {
+			continue
+		}
+		name := strings.TrimSuffix(attrID, suffix)
+		if strings.HasSuffix(name, "High") {
+			quantity, limit = strings.TrimSuffix(name, "High"), AlarmLimitHigh
+		} else if strings.HasSuffix(name, "Low") {
+			quantity, limit = strings.TrimSuffix(name, "Low"), AlarmLimitLow
+		} else {
+			return "", "", "", false
+		}
+		_, isAlarm = AlarmVocab[quantity]
+		return quantity, limit, suffix, isAlarm
+	}
+	return "", "", "", false
+}
+
+// AlarmQuantity returns the quantity of an alarm state or threshold attribute.
+// For example, "TemperatureHighAlarmValue" returns "Temperature".
+func AlarmQuantity(attrID string) (quantity string, isAlarm bool) {
+	quantity, _, _, isAlarm = parseAlarmID(attrID)
+	return quantity, isAlarm
+}
+
+// alarmTitle returns the title of an alarm attribute
+func alarmTitle(quantity, limit, suffix string) string {
+	title := AlarmVocab[quantity].title
+	if limit == AlarmLimitHigh {
+		title += " High Alarm"
+	} else {
+		title += " Low Alarm"
+	}
+	if suffix == "AlarmValue" {
+		title += " Threshold"
+	}
+	return title
+}
+
+// addAlarmAttr adds the alarm state or threshold attribute to the node's alarm list
+func (owNode *OneWireNode) addAlarmAttr(quantity, limit, suffix string, attr OneWireAttr) {
+	alarmID := quantity + strings.ToUpper(limit[:1]) + limit[1:]
+	alarm, found := owNode.Alarms[alarmID]
+	if !found {
+		alarm = &OneWireAlarm{ID: alarmID, Quantity: quantity, Limit: limit}
+		owNode.Alarms[alarmID] = alarm
+	}
+	if suffix == "AlarmState" {
+		alarm.Active = attr.Value != "0" && attr.Value != ""
+	} else {
+		alarm.Threshold = attr.Value
+		alarm.Unit = attr.Unit
+	}
+}
+
+// alarmDataType returns the data type of the alarm attribute
+func alarmDataType(suffix string) string {
+	if suffix == "AlarmState" {
+		return vocab.WoTDataTypeBool
+	}
+	return vocab.WoTDataTypeNumber
+}
@@ -0,0 +1,118 @@
+package eds
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// FamilyDS18B20 is the family code of the DS18B20 programmable resolution thermometer
+const FamilyDS18B20 = "28"
+
+// DS18B20 attribute names as used by the OWServer
+const (
+	DS18B20Resolution  = "Resolution"
+	DS18B20PowerSource = "PowerSource"
+	DS18B20TH          = "UserByte1" // TH alarm register
+	DS18B20TL          = "UserByte2" // TL alarm register
+)
+
+// Factory default values of the TH and TL user bytes. The OWServer uses them as user data,
+// so with these values the thresholds were not set deliberately.
+const (
+	ds18b20DefaultTH = 75
+	ds18b20DefaultTL = 70
+)
+
+// DS18B20ParasitePowerID is the attribute ID of the parasite power status
+const DS18B20ParasitePowerID = "parasitePower"
+
+// ds18b20ResolutionDescription describes the trade-off between resolution and conversion time
+const ds18b20ResolutionDescription = "Resolution in bits. A higher resolution increases the conversion time: " +
+	"9 bits is 0.5°C in 94ms, 10 bits is 0.25°C in 188ms, 11 bits is 0.125°C in 375ms, " +
+	"12 bits is 0.0625°C in 750ms."
+
+// ds18b20Attributes replaces the raw DS18B20 resolution, power source and user bytes with
+// the resolution enum, the parasite power status and the TH/TL alarm thresholds in °C.
+// The thresholds are hardware alarms that are active when the temperature reaches them.
+// Alarms are only derived when the thresholds were set deliberately: TL is below TH and
+// they are not the factory defaults.
+// The resolution is writable if the gateway supports changing it.
+func ds18b20Attributes(owNode *OneWireNode) {
+	if attr, found := owNode.Attr[DS18B20Resolution]; found {
+		attr.Name = "Resolution"
+		attr.DataType = vocab.WoTDataTypeInteger
+		attr.Enum = []string{"9", "10", "11", "12"}
+		attr.Description = ds18b20ResolutionDescription
+		owNode.Attr[DS18B20Resolution] = attr
+	}
+	// the DS18B20 pulls the bus low when reading the power supply while parasite powered
+	if attr, found := owNode.Attr[DS18B20PowerSource]; found {
+		delete(owNode.Attr, DS18B20PowerSource)
+		attr.Name = "Parasite powered"
+		attr.Value = strconv.Itoa(boolInt(attr.Value == "0"))
+		attr.DataType = vocab.WoTDataTypeBool
+		attr.Writable = false
+		owNode.Attr[DS18B20ParasitePowerID] = attr
+	}
+	temperature, tempErr := strconv.ParseFloat(owNode.Attr["Temperature"].Value, 64)
+	rawTH, errTH := ds18b20Register(owNode.Attr[DS18B20TH].Value)
+	rawTL, errTL := ds18b20Register(owNode.Attr[DS18B20TL].Value)
+	armed := errTH == nil && errTL == nil && rawTL < rawTH &&
+		!(rawTH == ds18b20DefaultTH && rawTL == ds18b20DefaultTL)
+	for _, th := range []struct{ attrID, limit string }{
+		{DS18B20TH, AlarmLimitHigh}, {DS18B20TL, AlarmLimitLow}} {
+
+		attr, found := owNode.Attr[th.attrID]
+		if !found {
+			continue
+		}
+		raw, err := ds18b20Register(attr.Value)
+		if err != nil {
+			continue
+		}
+		delete(owNode.Attr, th.attrID)
+		attr.Name = alarmTitle("Temperature", th.limit, "AlarmValue")
+		attr.VocabType = VocabAlarmThreshold
+		attr.Value = strconv.Itoa(raw)
+		attr.Unit = vocab.UnitNameCelcius
+		attr.DataType = vocab.WoTDataTypeInteger
+		attr.Min = -55
+		attr.Max = 125
+		affordanceID := "TemperatureHighAlarmValue"
+		if th.limit == AlarmLimitLow {
+			affordanceID = "TemperatureLowAlarmValue"
+		}
+		owNode.Attr[affordanceID] = attr
+		owNode.addAlarmAttr("Temperature", th.limit, "AlarmValue", attr)
+
+		// the DS18B20 alarm condition exists when the temperature is at or beyond TH or TL
+		active := armed && tempErr == nil &&
+			((th.limit == AlarmLimitHigh && temperature >= float64(raw)) ||
+				(th.limit == AlarmLimitLow && temperature <= float64(raw)))
+		owNode.addAlarmAttr("Temperature", th.limit, "AlarmState",
+			OneWireAttr{Value: strconv.Itoa(boolInt(active))})
+	}
+}
+
+// ds18b20Register returns the temperature in °C of the TH or TL register, a signed byte
+func ds18b20Register(value string) (int, error) {
+	raw, err := strconv.Atoi(value)
+	if err == nil && raw > 127 {
+		raw -= 256
+	}
+	return raw, err
+}
+
+// DS18B20ThresholdValue converts a threshold in °C to the value of the TH or TL register
+func DS18B20ThresholdValue(celsius string) (string, error) {
+	value, err := strconv.ParseFloat(celsius, 64)
+	if err != nil {
+		return "", err
+	} else if value < -55 || value > 125 {
+		return "", fmt.Errorf("threshold %s is outside the range of -55 to 125 °C", celsius)
+	}
+	return strconv.Itoa(int(math.Round(value)) & 0xFF), nil
+}
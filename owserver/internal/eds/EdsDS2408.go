@@ -0,0 +1,137 @@
+package eds
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// FamilyDS2408 is the family code of the DS2408 8-channel addressable switch
+const FamilyDS2408 = "29"
+
+// DS2408 register names as used by the OWServer. Each register holds one bit per channel.
+const (
+	DS2408LogicState        = "PIOLogicState"              // current pin state
+	DS2408OutputLatchState  = "PIOOutputLatchState"        // output transistor latch, 0 is conducting
+	DS2408ActivityLatch     = "PIOActivityLatchState"      // set when the pin changed since last reset
+	DS2408ActivityLatchRset = "PIOActivityLatchStateReset" // write to clear the activity latches
+)
+
+// DS2408Channels is the number of channels of the DS2408
+const DS2408Channels = 8
+
+// VocabSwitch is the sensor and actuator type of a switch channel
+const VocabSwitch = "switch"
+
+// EventNameActivity is the event ID that reports the channel number of a latched input activity
+const EventNameActivity = "activity"
+
+// DS2408ChannelID returns the sensor event ID of a channel 1..8
+func DS2408ChannelID(channel int) string {
+	return fmt.Sprintf("channel%d", channel)
+}
+
+// DS2408OutputID returns the action ID of an output channel 1..8
+func DS2408OutputID(channel int) string {
+	return fmt.Sprintf("output%d", channel)
+}
+
+// registerValue returns the value of an 8 bit register attribute of the node
+func (owNode *OneWireNode) registerValue(attrID string) (value int, found bool) {
+	attr, found := owNode.Attr[attrID]
+	if !found {
+		return 0, false
+	}
+	value, err := strconv.Atoi(attr.Value)
+	return value, err == nil
+}
+
+// DS2408OutputLatch returns the value of the output latch register of a DS2408 node
+func DS2408OutputLatch(owNode *OneWireNode) (outputLatch int, found bool) {
+	return owNode.registerValue(DS2408OutputLatchState)
+}
+
+// DS2408AddChannels adds a boolean sensor attribute for each of the 8 channels of a DS2408 node,
+// and a writable boolean actuator for each channel that is configured as output.
+// The channels replace the raw PIO registers, which are removed from the node. Use
+// DS2408ActiveChannels and DS2408OutputLatch to read the registers before adding the channels.
+//
+//	outputs is the list of channels 1..8 that are used as output
+func DS2408AddChannels(owNode *OneWireNode, outputs []int) {
+	logicState, found := owNode.registerValue(DS2408LogicState)
+	if !found {
+		return
+	}
+	outputLatch, _ := owNode.registerValue(DS2408OutputLatchState)
+	for _, register := range []string{
+		DS2408LogicState, DS2408OutputLatchState, DS2408ActivityLatch, DS2408ActivityLatchRset} {
+		delete(owNode.Attr, register)
+	}
+	for ch := 1; ch <= DS2408Channels; ch++ {
+		bit := 1 << (ch - 1)
+		owNode.Attr[DS2408ChannelID(ch)] = OneWireAttr{
+			ID:        DS2408LogicState,
+			Name:      fmt.Sprintf("Channel %d", ch),
+			VocabType: VocabSwitch,
+			Value:     strconv.Itoa(boolInt(logicState&bit != 0)),
+			IsSensor:  true,
+			DataType:  vocab.WoTDataTypeBool,
+		}
+	}
+	for _, ch := range outputs {
+		if ch < 1 || ch > DS2408Channels {
+			continue
+		}
+		bit := 1 << (ch - 1)
+		// the output is on when the output transistor conducts, eg when the latch bit is 0
+		owNode.Attr[DS2408OutputID(ch)] = OneWireAttr{
+			ID:         DS2408OutputLatchState,
+			Name:       fmt.Sprintf("Output %d", ch),
+			VocabType:  VocabSwitch,
+			Value:      strconv.Itoa(boolInt(outputLatch&bit == 0)),
+			IsActuator: true,
+			Writable:   true,
+			DataType:   vocab.WoTDataTypeBool,
+		}
+	}
+}
+
+// DS2408ActiveChannels returns the channels 1..8 whose activity latch is set
+func DS2408ActiveChannels(owNode *OneWireNode) (channels []int) {
+	activity, _ := owNode.registerValue(DS2408ActivityLatch)
+	for ch := 1; ch <= DS2408Channels; ch++ {
+		if activity&(1<<(ch-1)) != 0 {
+			channels = append(channels, ch)
+		}
+	}
+	return channels
+}
+
+// DS2408OutputValue returns the new output latch register value for switching an output channel.
+//
+//	outputLatch is the current value of the output latch register
+//	actionID is the output action ID, eg output1
+//	on is the requested output state
+func DS2408OutputValue(outputLatch int, actionID string, on bool) (int, error) {
+	var ch int
+	_, err := fmt.Sscanf(actionID, "output%d", &ch)
+	if err != nil || ch < 1 || ch > DS2408Channels {
+		return 0, fmt.Errorf("'%s' is not a DS2408 output", actionID)
+	}
+	bit := 1 << (ch - 1)
+	if on {
+		outputLatch &^= bit
+	} else {
+		outputLatch |= bit
+	}
+	return outputLatch, nil
+}
+
+// boolInt returns 1 for true and 0 for false
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
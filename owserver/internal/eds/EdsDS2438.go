@@ -0,0 +1,106 @@
+package eds
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// FamilyDS2438 is the family code of the DS2438 smart battery monitor
+const FamilyDS2438 = "26"
+
+// DS2438 profile names
+const (
+	// DS2438ProfileHIH computes relative humidity from a HIH-series humidity sensor on VAD
+	DS2438ProfileHIH = "hih"
+)
+
+// DS2438 attribute names as used by the OWServer
+const (
+	DS2438VAD    = "VAD"    // general purpose A/D input
+	DS2438VDD    = "VDD"    // supply voltage
+	DS2438Vsense = "Vsense" // current sense voltage
+)
+
+// DS2438HumidityID is the attribute ID of the computed relative humidity
+const DS2438HumidityID = "Humidity"
+
+// DS2438CurrentID is the attribute ID of the current computed from the sense voltage
+const DS2438CurrentID = "Current"
+
+// DS2438SenseResistor is the sense resistor in Ohm of the DS2438 reference circuit
+const DS2438SenseResistor = 0.05
+
+// UnitNameAmpere is the unit of the current
+const UnitNameAmpere = "A"
+
+func init() {
+	SensorTypeVocab[DS2438VAD] = sensorTypeInfo{
+		sensorType: VocabVoltage, name: "A/D Voltage", dataType: vocab.WoTDataTypeNumber, decimals: 2}
+	SensorTypeVocab[DS2438VDD] = sensorTypeInfo{
+		sensorType: VocabVoltage, name: "Supply Voltage", dataType: vocab.WoTDataTypeNumber, decimals: 2}
+	SensorTypeVocab[DS2438Vsense] = sensorTypeInfo{
+		sensorType: VocabVoltage, name: "Current Sense Voltage", dataType: vocab.WoTDataTypeNumber, decimals: 4}
+}
+
+// HIHHumidity returns the temperature compensated relative humidity of a HIH-4000 series
+// sensor, using the formula from the Honeywell datasheet.
+//
+//	vad is the sensor output voltage
+//	vdd is the sensor supply voltage
+//	temp is the temperature in degrees Celsius
+func HIHHumidity(vad, vdd, temp float64) float64 {
+	if vdd <= 0 {
+		return 0
+	}
+	sensorRH := (vad/vdd - 0.16) / 0.0062
+	trueRH := sensorRH / (1.0546 - 0.00216*temp)
+	return math.Max(0, math.Min(100, trueRH))
+}
+
+// DS2438AddHumidity adds the relative humidity attribute to a DS2438 node that uses the
+// HIH humidity profile. This requires the VAD, VDD and Temperature attributes.
+func DS2438AddHumidity(owNode *OneWireNode) {
+	vad, err1 := strconv.ParseFloat(owNode.Attr[DS2438VAD].Value, 64)
+	vdd, err2 := strconv.ParseFloat(owNode.Attr[DS2438VDD].Value, 64)
+	temp, err3 := strconv.ParseFloat(owNode.Attr["Temperature"].Value, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+	humidity := HIHHumidity(vad, vdd, temp)
+	owNode.Attr[DS2438HumidityID] = OneWireAttr{
+		ID:        DS2438HumidityID,
+		Name:      SensorTypeVocab["Humidity"].name,
+		VocabType: vocab.VocabHumidity,
+		Unit:      vocab.UnitNamePercent,
+		Value:     strconv.FormatFloat(humidity, 'f', 1, 64),
+		IsSensor:  true,
+		DataType:  vocab.WoTDataTypeNumber,
+		Decimals:  1,
+	}
+}
+
+// DS2438AddCurrent adds the current through the sense resistor to a DS2438 node.
+// This requires the Vsense attribute.
+//
+//	senseResistor is the sense resistor in Ohm, or 0 for the reference circuit resistor
+func DS2438AddCurrent(owNode *OneWireNode, senseResistor float64) {
+	vsense, err := strconv.ParseFloat(owNode.Attr[DS2438Vsense].Value, 64)
+	if err != nil {
+		return
+	}
+	if senseResistor <= 0 {
+		senseResistor = DS2438SenseResistor
+	}
+	owNode.Attr[DS2438CurrentID] = OneWireAttr{
+		ID:        DS2438CurrentID,
+		Name:      "Current",
+		VocabType: VocabCurrent,
+		Unit:      UnitNameAmpere,
+		Value:     RoundValue(vsense/senseResistor, 3),
+		IsSensor:  true,
+		DataType:  vocab.WoTDataTypeNumber,
+		Decimals:  3,
+	}
+}
@@ -0,0 +1,32 @@
+package eds
+
+import (
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// FamilyDS2450 is the family code of the DS2450 quad A/D converter
+const FamilyDS2450 = "20"
+
+// DS2450 channel names A-D
+var DS2450Channels = []string{"A", "B", "C", "D"}
+
+// VocabVoltage is the sensor type of A/D converter inputs
+const VocabVoltage = "voltage"
+
+// DS2450InputID returns the attribute ID of the conversion value of a channel A-D
+func DS2450InputID(channel string) string {
+	return "Channel" + channel + "ConversionValue"
+}
+
+func init() {
+	// each channel has an input and its conversion settings
+	for _, ch := range DS2450Channels {
+		SensorTypeVocab[DS2450InputID(ch)] = sensorTypeInfo{
+			sensorType: VocabVoltage, name: "Input " + ch, dataType: vocab.WoTDataTypeNumber, decimals: 3}
+		// the input range is either 2.56 or 5.12 volt
+		ConfigVocab["Channel"+ch+"ConversionRange"] = configInfo{
+			title: "Input " + ch + " range", unit: vocab.UnitNameVolt, enum: []string{"2.56", "5.12"}}
+		ConfigVocab["Channel"+ch+"ConversionResolution"] = configInfo{
+			title: "Input " + ch + " resolution", unit: "bits", min: 1, max: 16}
+	}
+}
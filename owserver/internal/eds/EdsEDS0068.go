@@ -0,0 +1,44 @@
+package eds
+
+import (
+	"fmt"
+)
+
+// VocabLED is the sensor and actuator type of the EDS0068 LED
+const VocabLED = "led"
+
+// EdsFunctionManual is the value of the LED and relay function that enables manual control
+const EdsFunctionManual = "2"
+
+// edsFunctionEnum lists the values of the EDS0068 LEDFunction and RelayFunction registers
+var edsFunctionEnum = []string{"0", "1", "2", "3"}
+
+// edsFunctionTitles are the titles of the EDS0068 LEDFunction and RelayFunction values
+var edsFunctionTitles = []string{
+	"Alarm",         // on while any alarm is active
+	"Alarm latched", // on when an alarm triggered, until alarms are cleared
+	"Manual",        // controlled by LEDState or RelayState
+	"Off",           // disabled
+}
+
+func init() {
+	ConfigVocab["LEDFunction"] = configInfo{
+		title: "LED Function", enum: edsFunctionEnum, enumTitles: edsFunctionTitles}
+	ConfigVocab["RelayFunction"] = configInfo{
+		title: "Relay Function", enum: edsFunctionEnum, enumTitles: edsFunctionTitles}
+}
+
+// ActuatorEnabled returns an error if the actuator of the node does not accept writes.
+// The EDS0068 LED and relay only accept writes when their function is set to manual.
+func ActuatorEnabled(owNode *OneWireNode, attr OneWireAttr) error {
+	actuatorInfo, found := lookupActuator(owNode.Model, attr.ID)
+	if !found || actuatorInfo.functionID == "" {
+		return nil
+	}
+	function, found := owNode.Attr[actuatorInfo.functionID]
+	if found && function.Value != EdsFunctionManual {
+		return fmt.Errorf("'%s' is not under manual control. %s is %s",
+			attr.ID, actuatorInfo.functionID, function.Value)
+	}
+	return nil
+}
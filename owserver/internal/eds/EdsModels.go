@@ -0,0 +1,144 @@
+package eds
+
+import (
+	"fmt"
+
+	"github.com/hiveot/hub/api/go/vocab"
+)
+
+// Device types of EDS00xx models that have no equivalent in the vocabulary
+const (
+	DeviceTypeADConverter    = "adconverter"
+	DeviceTypeBarometer      = "barometer"
+	DeviceTypeCurrentLoop    = "currentLoop"
+	DeviceTypeHygrometer     = "hygrometer"
+	DeviceTypeLightSensor    = "lightSensor"
+	DeviceTypePressureSensor = "pressureSensor"
+	DeviceTypeVibration      = "vibrationSensor"
+)
+
+// Sensor types of EDS00xx models that have no equivalent in the vocabulary
+const (
+	VocabCurrent    = "current"
+	VocabPressure   = "pressure"
+	VocabResistance = "resistance"
+	VocabVibration  = "vibration"
+)
+
+// edsModelInfo describes the elements of an EDS00xx model that share the 7E family code
+type edsModelInfo struct {
+	deviceType string
+	// model specific sensors. These take precedence over SensorTypeVocab
+	sensors map[string]sensorTypeInfo
+	// model specific actuators. These take precedence over ActuatorTypeVocab
+	actuators map[string]actuatorTypeInfo
+	// quantities that have hardware alarms. Nil to allow all quantities in AlarmVocab.
+	alarms []string
+}
+
+// EdsModelVocab maps the EDS model name, as reported in the Name element, to its description
+var EdsModelVocab = map[string]edsModelInfo{
+	"EDS0064": {deviceType: vocab.DeviceTypeThermometer,
+		alarms: []string{"Temperature"}},
+	"EDS0065": {deviceType: DeviceTypeHygrometer,
+		alarms: []string{"Temperature", "Humidity", "DewPoint", "HeatIndex"}},
+	"EDS0066": {deviceType: DeviceTypeBarometer,
+		alarms: []string{"Temperature", "BarometricPressureMb"}},
+	"EDS0067": {deviceType: DeviceTypeLightSensor,
+		alarms: []string{"Temperature", "Light"}},
+	"EDS0068": {deviceType: vocab.DeviceTypeMultisensor,
+		alarms: []string{"Temperature", "Humidity", "DewPoint", "HeatIndex", "BarometricPressureMb", "Light"}},
+	"EDS0070": {deviceType: DeviceTypeVibration,
+		sensors: map[string]sensorTypeInfo{
+			"VibrationInstant": {sensorType: VocabVibration, name: "Vibration", dataType: vocab.WoTDataTypeNumber, decimals: 0},
+			"VibrationPeak":    {sensorType: VocabVibration, name: "Vibration Peak", dataType: vocab.WoTDataTypeNumber, decimals: 0},
+			"VibrationMinimum": {sensorType: VocabVibration, name: "Vibration Minimum", dataType: vocab.WoTDataTypeNumber, decimals: 0},
+		},
+		alarms: []string{"VibrationInstant"}},
+	"EDS0071": {deviceType: vocab.DeviceTypeThermometer,
+		sensors: map[string]sensorTypeInfo{
+			"Temperature": {sensorType: vocab.VocabTemperature, name: "RTD Temperature", dataType: vocab.WoTDataTypeNumber, decimals: 2},
+			"Resistance":  {sensorType: VocabResistance, name: "RTD Resistance", dataType: vocab.WoTDataTypeNumber, decimals: 2},
+		},
+		alarms: []string{"Temperature"}},
+	"EDS0080": {deviceType: DeviceTypeADConverter,
+		sensors: numberedSensors("Input%dVoltage", "Input %d", VocabVoltage, 8, 3),
+		alarms:  []string{}},
+	"EDS0082": {deviceType: DeviceTypeADConverter,
+		sensors: numberedSensors("Input%dVoltage", "Input %d", VocabVoltage, 4, 3),
+		alarms:  []string{}},
+	"EDS0083": {deviceType: DeviceTypeCurrentLoop,
+		sensors: numberedSensors("Input%dCurrent", "Input %d", VocabCurrent, 4, 2),
+		alarms:  []string{}},
+	"EDS0085": {deviceType: DeviceTypePressureSensor,
+		sensors: map[string]sensorTypeInfo{
+			"Pressure": {sensorType: VocabPressure, name: "Pressure", dataType: vocab.WoTDataTypeNumber, decimals: 1},
+		},
+		alarms: []string{"Temperature", "Pressure"}},
+	"EDS0090": {deviceType: vocab.DeviceTypeBinarySwitch,
+		sensors:   numberedSensors("Input%dState", "Input %d", VocabSwitch, 8, 0),
+		actuators: numberedActuators("Output%dState", "Output %d", VocabSwitch, 8),
+		alarms:    []string{}},
+}
+
+// numberedSensors returns the sensor vocabulary of a model with numbered inputs
+//
+//	nameFmt is the EDS element name format, eg "Input%dVoltage"
+//	titleFmt is the title format, eg "Input %d"
+//	count is the number of inputs, numbered from 1
+//	decimals is the number of decimals of numeric sensors. Use 0 for boolean sensors.
+func numberedSensors(nameFmt, titleFmt, sensorType string, count int, decimals int) map[string]sensorTypeInfo {
+	dataType := vocab.WoTDataTypeNumber
+	if sensorType == VocabSwitch {
+		dataType = vocab.WoTDataTypeBool
+	}
+	sensors := make(map[string]sensorTypeInfo)
+	for i := 1; i <= count; i++ {
+		sensors[fmt.Sprintf(nameFmt, i)] = sensorTypeInfo{
+			sensorType: sensorType, name: fmt.Sprintf(titleFmt, i), dataType: dataType, decimals: decimals}
+	}
+	return sensors
+}
+
+// numberedActuators returns the boolean actuator vocabulary of a model with numbered outputs
+func numberedActuators(nameFmt, titleFmt, actuatorType string, count int) map[string]actuatorTypeInfo {
+	actuators := make(map[string]actuatorTypeInfo)
+	for i := 1; i <= count; i++ {
+		actuators[fmt.Sprintf(nameFmt, i)] = actuatorTypeInfo{
+			actuatorType: actuatorType, title: fmt.Sprintf(titleFmt, i), dataType: vocab.WoTDataTypeBool}
+	}
+	return actuators
+}
+
+// lookupSensor returns the sensor info of an attribute of the given model
+func lookupSensor(model string, attrID string) (info sensorTypeInfo, found bool) {
+	info, found = EdsModelVocab[model].sensors[attrID]
+	if !found {
+		info, found = SensorTypeVocab[attrID]
+	}
+	return info, found
+}
+
+// lookupActuator returns the actuator info of an attribute of the given model
+func lookupActuator(model string, attrID string) (info actuatorTypeInfo, found bool) {
+	info, found = EdsModelVocab[model].actuators[attrID]
+	if !found {
+		info, found = ActuatorTypeVocab[attrID]
+	}
+	return info, found
+}
+
+// modelHasAlarm returns true if the model supports hardware alarms of the quantity.
+// Unknown models support all alarms in AlarmVocab.
+func modelHasAlarm(model string, quantity string) bool {
+	modelInfo, found := EdsModelVocab[model]
+	if !found || modelInfo.alarms == nil {
+		return true
+	}
+	for _, q := range modelInfo.alarms {
+		if q == quantity {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package eds
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hiveot/hub/api/go/vocab"
+	"github.com/sirupsen/logrus"
+)
+
+// AttrInvalidNodes is the gateway attribute with the number of nodes that were rejected
+// because of an invalid ROM ID
+const AttrInvalidNodes = "invalidNodes"
+
+// rejectedNodes holds the reason a node was rejected, to log each rejected node once
+var rejectedNodes = make(map[string]string)
+var rejectedNodesMux sync.Mutex
+
+// CRC8 returns the Dallas/Maxim 1-wire CRC8 of the data (polynomial x^8 + x^5 + x^4 + 1)
+func CRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 0x01
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8C
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
+
+// ParseROMId validates a ROM ID as reported by the OWServer and returns its family code.
+// The OWServer reports the ROM most significant byte first, eg "2A000003BB170B28" has
+// CRC 2A, serial number 000003BB170B and family 28.
+// This returns an error if the ROM ID is not 8 hex bytes or the CRC doesn't match.
+func ParseROMId(romID string) (family string, err error) {
+	if romID == "" {
+		return "", fmt.Errorf("missing ROM ID")
+	}
+	rom, err := hex.DecodeString(romID)
+	if err != nil || len(rom) != 8 {
+		return "", fmt.Errorf("ROM ID '%s' is not 8 hex bytes", romID)
+	}
+	// the CRC is computed over the family and serial number, in bus order
+	var busOrder [7]byte
+	for i := 0; i < 7; i++ {
+		busOrder[i] = rom[7-i]
+	}
+	if crc := CRC8(busOrder[:]); crc != rom[0] {
+		return "", fmt.Errorf("ROM ID '%s' has CRC %02X, expected %02X", romID, rom[0], crc)
+	}
+	return fmt.Sprintf("%02X", rom[7]), nil
+}
+
+// validateNodes removes the nodes with an invalid ROM ID, or whose family doesn't match the
+// ROM, from the list. The number of rejected nodes is recorded in the gateway node, which
+// is the first node of the list. Each rejected node is logged once.
+func validateNodes(nodes []*OneWireNode) []*OneWireNode {
+	gateway := nodes[0]
+	validNodes := []*OneWireNode{gateway}
+	invalidCount := 0
+	for _, node := range nodes[1:] {
+		family, err := ParseROMId(node.NodeID)
+		if err == nil && !strings.EqualFold(node.Family, family) {
+			err = fmt.Errorf("family '%s' doesn't match the ROM family '%s'", node.Family, family)
+		}
+		if err != nil {
+			rejectedNodesMux.Lock()
+			if rejectedNodes[node.NodeID] != err.Error() {
+				rejectedNodes[node.NodeID] = err.Error()
+				logrus.Warningf("rejected node '%s' (%s): %s", node.NodeID, node.Name, err)
+			}
+			rejectedNodesMux.Unlock()
+			invalidCount++
+			continue
+		}
+		validNodes = append(validNodes, node)
+	}
+	gateway.Attr[AttrInvalidNodes] = OneWireAttr{
+		ID:        AttrInvalidNodes,
+		Name:      "Rejected nodes with an invalid ROM ID",
+		VocabType: AttrInvalidNodes,
+		Value:     fmt.Sprintf("%d", invalidCount),
+		DataType:  vocab.WoTDataTypeInteger,
+	}
+	return validNodes
+}
@@ -0,0 +1,202 @@
+// Package expr evaluates arithmetic expressions over sensor values
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LookupFn returns the value of a variable in an expression, eg "2A000003BB170B28.Temperature"
+type LookupFn func(name string) (value float64, found bool)
+
+// functions that can be used in expressions, by name and number of arguments
+var functions = map[string]struct {
+	nargs int
+	fn    func(args []float64) float64
+}{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"ln":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+}
+
+// parser is a recursive descent parser that evaluates while parsing
+//
+//	expression = term {("+"|"-") term}
+//	term       = unary {("*"|"/") unary}
+//	unary      = ["-"|"+"] factor
+//	factor     = number | variable | function "(" expression {"," expression} ")" | "(" expression ")"
+type parser struct {
+	tokens []string
+	pos    int
+	lookup LookupFn
+}
+
+// tokenize splits the expression into numbers, names and operators
+func tokenize(expression string) (tokens []string, err error) {
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if unicode.IsSpace(r) {
+			i++
+		} else if strings.ContainsRune("+-*/(),", r) {
+			tokens = append(tokens, string(r))
+			i++
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' {
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) ||
+				runes[i] == '.' || runes[i] == '_') {
+				i++
+			}
+			// the signed exponent of a number in scientific notation, eg 1e-5
+			if isMantissa(runes[start:i]) && i+1 < len(runes) &&
+				(runes[i] == '-' || runes[i] == '+') && unicode.IsDigit(runes[i+1]) {
+				i++
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		} else {
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+// isMantissa returns true if the token is a number followed by the exponent marker 'e'
+func isMantissa(token []rune) bool {
+	n := len(token)
+	if n < 2 || (token[n-1] != 'e' && token[n-1] != 'E') {
+		return false
+	}
+	_, err := strconv.ParseFloat(string(token[:n-1]), 64)
+	return err == nil
+}
+
+// peek returns the current token or "" at the end
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// next returns the current token and advances
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) expression() (float64, error) {
+	value, err := p.term()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		op := p.next()
+		var rhs float64
+		rhs, err = p.term()
+		if op == "+" {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+	return value, err
+}
+
+func (p *parser) term() (float64, error) {
+	value, err := p.unary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/") {
+		op := p.next()
+		var rhs float64
+		rhs, err = p.unary()
+		if op == "*" {
+			value *= rhs
+		} else {
+			value /= rhs
+		}
+	}
+	return value, err
+}
+
+func (p *parser) unary() (float64, error) {
+	if p.peek() == "-" {
+		p.next()
+		value, err := p.factor()
+		return -value, err
+	} else if p.peek() == "+" {
+		p.next()
+	}
+	return p.factor()
+}
+
+func (p *parser) factor() (float64, error) {
+	tok := p.next()
+	if tok == "" {
+		return 0, fmt.Errorf("unexpected end of expression")
+	} else if tok == "(" {
+		value, err := p.expression()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("missing ')'")
+		}
+		return value, err
+	} else if value, err := strconv.ParseFloat(tok, 64); err == nil {
+		return value, nil
+	} else if f, isFunction := functions[tok]; isFunction && p.peek() == "(" {
+		p.next()
+		args := make([]float64, 0, f.nargs)
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if p.next() != ")" {
+			return 0, fmt.Errorf("missing ')' after arguments of '%s'", tok)
+		} else if len(args) != f.nargs {
+			return 0, fmt.Errorf("function '%s' expects %d arguments", tok, f.nargs)
+		}
+		return f.fn(args), nil
+	} else if strings.ContainsRune("+-*/(),", rune(tok[0])) {
+		return 0, fmt.Errorf("unexpected '%s'", tok)
+	}
+	value, found := p.lookup(tok)
+	if !found {
+		return 0, fmt.Errorf("unknown variable '%s'", tok)
+	}
+	return value, nil
+}
+
+// Eval evaluates an arithmetic expression.
+// Expressions support numbers, including scientific notation, variables, the operators + - * / and parentheses, and the
+// functions abs, exp, ln, log10, sqrt, pow, min and max.
+//
+//	expression to evaluate, eg "2A000003BB170B28.Temperature - 49000001BCEAD428.Temperature"
+//	lookup returns the value of variables
+func Eval(expression string, lookup LookupFn) (float64, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return 0, err
+	}
+	p := &parser{tokens: tokens, lookup: lookup}
+	value, err := p.expression()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.peek())
+	}
+	if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		err = fmt.Errorf("expression result is not a number")
+	}
+	return value, err
+}
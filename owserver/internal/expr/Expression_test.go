@@ -0,0 +1,63 @@
+package expr_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiveot/bindings/owserver/internal/expr"
+)
+
+var testValues = map[string]float64{
+	"2A000003BB170B28.Temperature": 20.375,
+	"49000001BCEAD428.Temperature": 20.25,
+	"C100100000267C7E.Humidity":    42.3,
+}
+
+func lookup(name string) (float64, bool) {
+	value, found := testValues[name]
+	return value, found
+}
+
+func TestEval(t *testing.T) {
+	value, err := expr.Eval("2A000003BB170B28.Temperature - 49000001BCEAD428.Temperature", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.125, value)
+
+	value, err = expr.Eval("-(1 + 2) * 3 / 2", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, -4.5, value)
+
+	value, err = expr.Eval("pow(2, 3) + max(1, sqrt(16)) + abs(-1)", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(13), value)
+
+	value, err = expr.Eval("2.5e-3 * 2E+2 + 1e2", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 100.5, value)
+
+	// absolute humidity in g/m3
+	value, err = expr.Eval("6.112 * exp(17.67 * 2A000003BB170B28.Temperature / "+
+		"(2A000003BB170B28.Temperature + 243.5)) * C100100000267C7E.Humidity * 2.1674 / "+
+		"(273.15 + 2A000003BB170B28.Temperature)", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 7.5, math.Round(value*10)/10)
+}
+
+func TestEvalErrors(t *testing.T) {
+	badExpressions := []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		"unknown.Temperature",
+		"pow(2)",
+		"1 / 0",
+		"1 % 2",
+	}
+	for _, expression := range badExpressions {
+		_, err := expr.Eval(expression, lookup)
+		assert.Error(t, err, "expected error for '%s'", expression)
+	}
+}
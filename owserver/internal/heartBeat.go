@@ -25,10 +25,12 @@ func (binding *OWServerBinding) heartBeat() {
 			nodes, err := binding.PollNodes()
 			if err == nil {
 				if tdCountDown <= 0 {
-					// Every TDInterval update the TD's and submit all properties
-					// create ExposedThing's as they are discovered
+					// Every TDInterval republish all TD's as a safety net
 					err = binding.PublishThings(nodes)
 					tdCountDown = binding.Config.TDInterval
+				} else {
+					// publish the TD of new nodes and of nodes whose structure changed
+					err = binding.PublishChangedThings(nodes)
 				}
 
 				_ = binding.PublishNodeValues(nodes)
@@ -0,0 +1,114 @@
+// Package i18n with the translations of TD titles and descriptions
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceLanguage is the language of the titles and descriptions in the binding source
+const SourceLanguage = "en"
+
+// placeholder in catalog texts that matches a single word or number, eg "Input {n}"
+const placeholder = "{n}"
+
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// Catalog holds the translations of English texts, by language
+type Catalog struct {
+	// translations by language and English text
+	texts map[string]map[string]string
+	// translations of texts with a placeholder, by language
+	patterns map[string][]pattern
+}
+
+// pattern is a text with a placeholder and its translation
+type pattern struct {
+	re          *regexp.Regexp
+	translation string
+}
+
+// AddTranslations adds or replaces translations of English texts, by language.
+// Texts can contain the {n} placeholder for a single word or number, eg "Input {n}".
+func (c *Catalog) AddTranslations(translations map[string]map[string]string) {
+	for lang, texts := range translations {
+		langTexts, found := c.texts[lang]
+		if !found {
+			langTexts = make(map[string]string)
+			c.texts[lang] = langTexts
+		}
+		for text, translation := range texts {
+			if !strings.Contains(text, placeholder) {
+				langTexts[text] = translation
+				continue
+			}
+			expr := "^" + strings.Replace(regexp.QuoteMeta(text), regexp.QuoteMeta(placeholder), `(\S+)`, 1) + "$"
+			c.patterns[lang] = append(c.patterns[lang], pattern{
+				re:          regexp.MustCompile(expr),
+				translation: translation,
+			})
+		}
+	}
+}
+
+// Translate returns the translation of an English text, or "" if no translation is known
+func (c *Catalog) Translate(text string, lang string) string {
+	if lang == SourceLanguage {
+		return text
+	}
+	if translation, found := c.texts[lang][text]; found {
+		return translation
+	}
+	// later patterns override earlier ones, like texts do
+	patterns := c.patterns[lang]
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if match := patterns[i].re.FindStringSubmatch(text); match != nil {
+			return strings.Replace(patterns[i].translation, placeholder, match[1], 1)
+		}
+	}
+	return ""
+}
+
+// Translations returns the text in each language that has a translation, including English.
+// This returns nil if the text has no translations.
+func (c *Catalog) Translations(text string) map[string]string {
+	var translations map[string]string
+	for lang := range c.texts {
+		if translation := c.Translate(text, lang); translation != "" {
+			if translations == nil {
+				translations = map[string]string{SourceLanguage: text}
+			}
+			translations[lang] = translation
+		}
+	}
+	return translations
+}
+
+// NewCatalog returns a catalog with the translations that are shipped with the binding.
+// Catalogs are JSON files named after their language, eg nl.json, that map English texts
+// to their translation.
+func NewCatalog() *Catalog {
+	c := &Catalog{
+		texts:    make(map[string]map[string]string),
+		patterns: make(map[string][]pattern),
+	}
+	entries, _ := catalogFiles.ReadDir("catalogs")
+	for _, entry := range entries {
+		data, err := catalogFiles.ReadFile(path.Join("catalogs", entry.Name()))
+		texts := make(map[string]string)
+		if err == nil {
+			err = json.Unmarshal(data, &texts)
+		}
+		if err != nil {
+			// the catalogs are part of the binding so this is a build error
+			panic("invalid catalog " + entry.Name() + ": " + err.Error())
+		}
+		lang := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		c.AddTranslations(map[string]map[string]string{lang: texts})
+	}
+	return c
+}
@@ -0,0 +1,29 @@
+package i18n_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiveot/bindings/owserver/internal/i18n"
+)
+
+func TestTranslate(t *testing.T) {
+	c := i18n.NewCatalog()
+	assert.Equal(t, "Dauwpunt", c.Translate("Dew point", "nl"))
+	assert.Equal(t, "Entrée 3", c.Translate("Input 3", "fr"))
+	assert.Equal(t, "", c.Translate("Unknown text", "nl"))
+
+	// translations can be added and replaced
+	c.AddTranslations(map[string]map[string]string{
+		"nl": {"Dew point": "Dauwpunttemperatuur", "Tank {n}": "Tank {n} niveau"},
+		"de": {"Dew point": "Taupunkt"},
+	})
+	assert.Equal(t, "Dauwpunttemperatuur", c.Translate("Dew point", "nl"))
+	assert.Equal(t, "Tank B niveau", c.Translate("Tank B", "nl"))
+
+	titles := c.Translations("Dew point")
+	assert.Equal(t, "Dew point", titles[i18n.SourceLanguage])
+	assert.Equal(t, "Taupunkt", titles["de"])
+	assert.Nil(t, c.Translations("Unknown text"))
+}
@@ -0,0 +1,107 @@
+package tdvalidate
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// tdSchemaURL is the ID of the W3C WoT TD 1.1 validation schema
+const tdSchemaURL = "https://raw.githubusercontent.com/w3c/wot-thing-description/main/validation/td-json-schema-validation.json"
+
+// tdSchemaJSON is the published TD 1.1 validation schema
+//
+//go:embed td-json-schema-validation.json
+var tdSchemaJSON []byte
+
+// hubProvided are the required TD fields that the Hub adds when it serves the TD.
+// Bindings publish TDs without forms and security definitions.
+var hubProvided = map[string]bool{"forms": true, "securityDefinitions": true}
+
+var tdSchema *jsonschema.Schema
+var tdSchemaOnce sync.Once
+
+// relaxSchema removes the Hub provided fields from the required fields of the schema and
+// its definitions.
+func relaxSchema(schema interface{}) {
+	switch node := schema.(type) {
+	case map[string]interface{}:
+		if required, isArray := node["required"].([]interface{}); isArray {
+			kept := make([]interface{}, 0, len(required))
+			for _, field := range required {
+				if name, _ := field.(string); !hubProvided[name] {
+					kept = append(kept, field)
+				}
+			}
+			node["required"] = kept
+		}
+		for _, child := range node {
+			relaxSchema(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			relaxSchema(child)
+		}
+	}
+}
+
+// getTDSchema returns the compiled TD schema for TDs published on the Hub.
+// Thing IDs on the Hub are not URIs, so the id format is not checked.
+func getTDSchema() *jsonschema.Schema {
+	tdSchemaOnce.Do(func() {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(tdSchemaJSON, &schema); err != nil {
+			panic("invalid embedded TD schema: " + err.Error())
+		}
+		relaxSchema(schema)
+		if props, found := schema["properties"].(map[string]interface{}); found {
+			if id, found := props["id"].(map[string]interface{}); found {
+				delete(id, "format")
+			}
+		}
+		schemaDoc, _ := json.Marshal(schema)
+		compiler := jsonschema.NewCompiler()
+		compiler.Draft = jsonschema.Draft7
+		if err := compiler.AddResource(tdSchemaURL, bytes.NewReader(schemaDoc)); err != nil {
+			panic("invalid embedded TD schema: " + err.Error())
+		}
+		tdSchema = compiler.MustCompile(tdSchemaURL)
+	})
+	return tdSchema
+}
+
+// schemaViolations converts a validation error into a list of violations.
+// Failed alternatives of anyOf and oneOf are reported as a single violation.
+func schemaViolations(ve *jsonschema.ValidationError, violations []Violation) []Violation {
+	keyword := ve.KeywordLocation[strings.LastIndex(ve.KeywordLocation, "/")+1:]
+	if len(ve.Causes) == 0 || keyword == "anyOf" || keyword == "oneOf" {
+		msg := ve.Message
+		if len(ve.Causes) > 0 {
+			msg = "doesn't match any of the allowed schemas"
+		}
+		path := strings.TrimPrefix(ve.InstanceLocation, "/")
+		return append(violations, Violation{Path: path, Message: msg})
+	}
+	for _, cause := range ve.Causes {
+		violations = schemaViolations(cause, violations)
+	}
+	return violations
+}
+
+// ValidateSchema checks a decoded TD against the W3C WoT TD 1.1 JSON schema and returns
+// the violations. Forms and security definitions are added by the Hub and not required.
+func ValidateSchema(td interface{}) []Violation {
+	err := getTDSchema().Validate(td)
+	var ve *jsonschema.ValidationError
+	if errors.As(err, &ve) {
+		return schemaViolations(ve, nil)
+	} else if err != nil {
+		return []Violation{{Message: err.Error()}}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package tdvalidate checks TD documents against the W3C WoT TD 1.1 JSON schema and HiveOT rules
+package tdvalidate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Violation describes a part of the TD that doesn't comply
+type Violation struct {
+	// Path to the offending element, eg "events/Temperature/data"
+	Path string
+	// Message describing the violation
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// validator collects violations of the HiveOT rules while walking the TD.
+// The structure of the TD is checked by the schema, so parts that don't match are skipped.
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) addf(path string, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// sortedKeys returns the keys of a JSON object in order, for a stable list of violations
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkAffordances validates the properties, actions or events of the TD
+func (v *validator) checkAffordances(td map[string]interface{}, kind string) {
+	affordances, _ := td[kind].(map[string]interface{})
+	for _, name := range sortedKeys(affordances) {
+		path := kind + "/" + name
+		if name == "" {
+			v.addf(kind, "affordance with an empty name")
+		}
+		aff, isObject := affordances[name].(map[string]interface{})
+		if !isObject {
+			continue
+		}
+		// events and actions are identified by their type from the vocabulary
+		if atType, found := aff["@type"]; !found && kind != "properties" {
+			v.addf(path, "missing '@type'")
+		} else if found && atType == "" {
+			v.addf(path, "empty '@type'")
+		}
+		switch kind {
+		case "properties":
+			// a property affordance is a data schema
+			v.checkDataSchema(aff, path)
+		case "actions":
+			v.checkSubSchema(aff, path, "input")
+			v.checkSubSchema(aff, path, "output")
+		case "events":
+			v.checkSubSchema(aff, path, "data")
+		}
+	}
+}
+
+// checkSubSchema validates the optional data schema in the field of an affordance
+func (v *validator) checkSubSchema(aff map[string]interface{}, path string, field string) {
+	if schema, isObject := aff[field].(map[string]interface{}); isObject {
+		v.checkDataSchema(schema, path+"/"+field)
+	}
+}
+
+// checkValue reports a violation if a value doesn't match the data type
+func (v *validator) checkValue(path string, dataType string, value interface{}) {
+	var matches bool
+	switch dataType {
+	case "boolean":
+		_, matches = value.(bool)
+	case "integer":
+		number, isNumber := value.(float64)
+		matches = isNumber && number == float64(int64(number))
+	case "number":
+		_, matches = value.(float64)
+	case "string":
+		_, matches = value.(string)
+	default:
+		matches = true
+	}
+	if !matches {
+		v.addf(path, "value '%v' is not of type '%s'", value, dataType)
+	}
+}
+
+// checkDataSchema validates a data schema and its nested schemas
+func (v *validator) checkDataSchema(schema map[string]interface{}, path string) {
+	dataType, _ := schema["type"].(string)
+	// data schemas have a type so consumers know how to render the value
+	if dataType == "" {
+		v.addf(path, "data schema without type")
+	}
+	isNumber := dataType == "number" || dataType == "integer"
+	minValue, hasMin := schema["minimum"].(float64)
+	maxValue, hasMax := schema["maximum"].(float64)
+	if (hasMin || hasMax) && !isNumber {
+		v.addf(path, "minimum and maximum only apply to numbers")
+	} else if hasMin && hasMax && minValue > maxValue {
+		v.addf(path, "minimum %v is larger than maximum %v", minValue, maxValue)
+	}
+	// enum values and the constants of oneOf match the data type
+	values, _ := schema["enum"].([]interface{})
+	for _, value := range values {
+		v.checkValue(path+"/enum", dataType, value)
+	}
+	schemas, _ := schema["oneOf"].([]interface{})
+	for i, item := range schemas {
+		itemSchema, _ := item.(map[string]interface{})
+		if constValue, found := itemSchema["const"]; found {
+			v.checkValue(path+"/oneOf/"+strconv.Itoa(i), dataType, constValue)
+		}
+	}
+	// the initial value is the value without unit
+	if initialValue, found := schema["initialValue"].(string); found && initialValue != "" {
+		var err error
+		switch dataType {
+		case "number", "integer":
+			_, err = strconv.ParseFloat(initialValue, 64)
+		case "boolean":
+			_, err = strconv.ParseBool(initialValue)
+		}
+		if err != nil {
+			v.addf(path, "initial value '%s' is not a %s", initialValue, dataType)
+		}
+	}
+	if properties, found := schema["properties"]; found {
+		props, _ := properties.(map[string]interface{})
+		if dataType != "object" {
+			v.addf(path, "properties only apply to objects")
+		}
+		for _, name := range sortedKeys(props) {
+			if propSchema, isObject := props[name].(map[string]interface{}); isObject {
+				v.checkDataSchema(propSchema, path+"/properties/"+name)
+			}
+		}
+	}
+	if items, isObject := schema["items"].(map[string]interface{}); isObject {
+		v.checkDataSchema(items, path+"/items")
+	}
+}
+
+// Validate checks a TD document and returns the violations.
+// The TD is first checked against the W3C WoT TD 1.1 JSON schema, see ValidateSchema.
+// This is followed by the HiveOT rules that the TD has a title, events and actions have a @type, data schemas
+// have a type, enum values match the type, and initial values don't include the unit.
+func Validate(tdDoc []byte) []Violation {
+	var td interface{}
+	if err := json.Unmarshal(tdDoc, &td); err != nil {
+		return []Violation{{Message: fmt.Sprintf("TD is not valid JSON: %s", err)}}
+	}
+	violations := ValidateSchema(td)
+	tdObject, isObject := td.(map[string]interface{})
+	if !isObject {
+		return violations
+	}
+	v := &validator{violations: violations}
+	if title, _ := tdObject["title"].(string); title == "" {
+		v.addf("", "empty 'title'")
+	}
+	v.checkAffordances(tdObject, "properties")
+	v.checkAffordances(tdObject, "actions")
+	v.checkAffordances(tdObject, "events")
+	return v.violations
+}
@@ -0,0 +1,49 @@
+package tdvalidate_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiveot/bindings/owserver/internal/tdvalidate"
+)
+
+func TestValidTD(t *testing.T) {
+	const tdDoc = `{"@context":["https://www.w3.org/2022/wot/td/v1.1"],"id":"28A1","title":"Thermometer","security":"",
+"properties":{"Resolution":{"title":"Resolution","type":"integer","enum":[9,10,11,12],"initialValue":"12"}},
+"events":{"Temperature":{"@type":"temperature","data":{"type":"number","multipleOf":0.1,"initialValue":"21.5"}}},
+"actions":{"clearAlarms":{"@type":"clearAlarms","title":"Clear Alarms"}}}`
+	violations := tdvalidate.Validate([]byte(tdDoc))
+	assert.Empty(t, violations)
+}
+
+func TestInvalidTD(t *testing.T) {
+	const tdDoc = `{"title":"",
+"properties":{"Resolution":{"type":"integer","enum":["9"],"minimum":12,"maximum":9,"multipleOf":0}},
+"actions":{"clearAlarms":{"@type":"clearAlarms","input":{"type":"float"}}},
+"events":{"Temperature":{"data":{"initialValue":"21.5 °C"}}}}`
+	violations := tdvalidate.Validate([]byte(tdDoc))
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	// violations of the TD 1.1 JSON schema
+	assert.Contains(t, messages, "missing properties: 'security', '@context'")
+	assert.Contains(t, messages, "properties/Resolution/multipleOf: must be > 0 but found 0")
+	assert.Contains(t, messages, "actions/clearAlarms/input/type: value must be one of \"boolean\", \"integer\", \"number\", \"string\", \"object\", \"array\", \"null\"")
+	// violations of the HiveOT rules
+	assert.Contains(t, messages, "empty 'title'")
+	assert.Contains(t, messages, "properties/Resolution: minimum 12 is larger than maximum 9")
+	assert.Contains(t, messages, "properties/Resolution/enum: value '9' is not of type 'integer'")
+	assert.Contains(t, messages, "events/Temperature: missing '@type'")
+	assert.Contains(t, messages, "events/Temperature/data: data schema without type")
+
+	assert.NotEmpty(t, tdvalidate.Validate([]byte("not json")))
+
+	// the 2019 and 2022 context URIs are accepted, others are not
+	const noContext = `{"@context":"http://www.w3.org/ns/td","title":"Thermometer","security":"nosec_sc"}`
+	violations = tdvalidate.Validate([]byte(noContext))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "@context", violations[0].Path)
+}